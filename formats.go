@@ -8,6 +8,7 @@ import (
 	"strings"
 
 	"github.com/rfyiamcool/pgcacher/pkg/pcstats"
+	"github.com/rfyiamcool/pgcacher/pkg/pgutils"
 )
 
 type PcStatusList []pcstats.PcStatus
@@ -43,7 +44,7 @@ func (stats PcStatusList) FormatUnicode() {
 	fmt.Println(hr)
 
 	for _, pcs := range stats {
-		pad = strings.Repeat(" ", maxName-len(pcs.Name))
+		pad = strings.Repeat(" ", maxName-len(displayName(pcs)))
 
 		// The cache is counted through the page，can't count accurately.
 		// Here cached file size is calculated by pcs.Size and pcs.Percent,
@@ -53,7 +54,7 @@ func (stats PcStatusList) FormatUnicode() {
 		// %-7.3f was chosen to make it easy to scan the percentages vertically
 		// I tried a few different formats only this one kept the decimals aligned
 		fmt.Printf("│ %s%s │ %-15s│ %-12d│ %-15s│ %-12d│ %-7.3f │\n",
-			pcs.Name, pad, ConvertUnit(pcs.Size), pcs.Pages, ConvertUnit(cached_size), pcs.Cached, pcs.Percent)
+			displayName(pcs), pad, ConvertUnit(pcs.Size), pcs.Pages, ConvertUnit(cached_size), pcs.Cached, pcs.Percent)
 
 		size_sum += pcs.Size
 		page_sum += int64(pcs.Pages)
@@ -64,7 +65,7 @@ func (stats PcStatusList) FormatUnicode() {
 	fmt.Println(hr)
 	pad = strings.Repeat(" ", maxName-len("Sum"))
 	fmt.Printf("│ %s%s │ %-15s│ %-12d│ %-15s│ %-12d│ %-7.3f │\n",
-		"Sum", pad, ConvertUnit(size_sum), page_sum, ConvertUnit(cached_size_sum), cached_page_sum, (float64(cached_page_sum)/float64(page_sum))*100.00)
+		"Sum", pad, ConvertUnit(size_sum), page_sum, ConvertUnit(cached_size_sum), cached_page_sum, percent(cached_page_sum, page_sum))
 	fmt.Println(bot)
 }
 
@@ -86,13 +87,13 @@ func (stats PcStatusList) FormatText() {
 	fmt.Println(hr)
 
 	for _, pcs := range stats {
-		pad = strings.Repeat(" ", maxName-len(pcs.Name))
+		pad = strings.Repeat(" ", maxName-len(displayName(pcs)))
 		cached_size = int64(float64(pcs.Size) * pcs.Percent / 100)
 
 		// %-7.3f was chosen to make it easy to scan the percentages vertically
 		// I tried a few different formats only this one kept the decimals aligned
 		fmt.Printf("| %s%s | %-15s| %-12d| %-15s| %-12d| %-7.3f |\n",
-			pcs.Name, pad, ConvertUnit(pcs.Size), pcs.Pages, ConvertUnit(cached_size), pcs.Cached, pcs.Percent)
+			displayName(pcs), pad, ConvertUnit(pcs.Size), pcs.Pages, ConvertUnit(cached_size), pcs.Cached, pcs.Percent)
 
 		size_sum += pcs.Size
 		page_sum += int64(pcs.Pages)
@@ -103,7 +104,7 @@ func (stats PcStatusList) FormatText() {
 	fmt.Println(hr)
 	pad = strings.Repeat(" ", maxName-len("Sum"))
 	fmt.Printf("│ %s%s │ %-15s│ %-12d│ %-15s│ %-12d│ %-7.3f │\n",
-		"Sum", pad, ConvertUnit(size_sum), page_sum, ConvertUnit(cached_size_sum), cached_page_sum, (float64(cached_page_sum)/float64(page_sum))*100.00)
+		"Sum", pad, ConvertUnit(size_sum), page_sum, ConvertUnit(cached_size_sum), cached_page_sum, percent(cached_page_sum, page_sum))
 	fmt.Println(bot)
 }
 
@@ -117,13 +118,13 @@ func (stats PcStatusList) FormatPlain() {
 	fmt.Printf("Name%s  Size            Pages        Cached Size     Cached Pages Percent\n", pad)
 
 	for _, pcs := range stats {
-		pad := strings.Repeat(" ", maxName-len(pcs.Name))
+		pad := strings.Repeat(" ", maxName-len(displayName(pcs)))
 		cached_size = int64(float64(pcs.Size) * pcs.Percent / 100)
 
 		// %-7.3f was chosen to make it easy to scan the percentages vertically
 		// I tried a few different formats only this one kept the decimals aligned
 		fmt.Printf("%s%s  %-15s %-12d %-15s %-12d %-7.3f\n",
-			pcs.Name, pad, ConvertUnit(pcs.Size), pcs.Pages, ConvertUnit(cached_size), pcs.Cached, pcs.Percent)
+			displayName(pcs), pad, ConvertUnit(pcs.Size), pcs.Pages, ConvertUnit(cached_size), pcs.Cached, pcs.Percent)
 
 		size_sum += pcs.Size
 		page_sum += int64(pcs.Pages)
@@ -133,7 +134,7 @@ func (stats PcStatusList) FormatPlain() {
 
 	pad = strings.Repeat(" ", maxName-len("Sum"))
 	fmt.Printf("%s%s  %-15s %-12d %-15s %-12d %-7.3f\n",
-		"Sum", pad, ConvertUnit(size_sum), page_sum, ConvertUnit(cached_size_sum), cached_page_sum, (float64(cached_page_sum)/float64(page_sum))*100.00)
+		"Sum", pad, ConvertUnit(size_sum), page_sum, ConvertUnit(cached_size_sum), cached_page_sum, percent(cached_page_sum, page_sum))
 }
 
 func (stats PcStatusList) FormatTerse() {
@@ -146,6 +147,34 @@ func (stats PcStatusList) FormatTerse() {
 	}
 }
 
+func (stats PcStatusList) FormatTable(opts pcstats.TableOptions) {
+	if err := pcstats.FormatTable(os.Stdout, stats, opts); err != nil {
+		log.Fatalf("table formatting failed: %s\n", err)
+	}
+}
+
+func (stats PcStatusList) FormatGrouped(opts pcstats.TableOptions, names map[pgutils.Oid]string) {
+	groups := pcstats.GroupByDatabase(stats, pgutils.DatabaseMapper(names))
+	if err := pcstats.FormatGrouped(os.Stdout, groups, opts); err != nil {
+		log.Fatalf("table formatting failed: %s\n", err)
+	}
+}
+
+func (pg *pgcacher) tableOptions() pcstats.TableOptions {
+	opts := pcstats.TableOptions{
+		SortBy:   pcstats.SortByPercent,
+		RelName:  pg.option.relName,
+		DirectIO: pg.option.directIO,
+	}
+	switch pg.option.sortBy {
+	case "name":
+		opts.SortBy = pcstats.SortByName
+	case "size":
+		opts.SortBy = pcstats.SortBySize
+	}
+	return opts
+}
+
 func (stats PcStatusList) FormatJson() {
 	b, err := json.Marshal(stats)
 	if err != nil {
@@ -155,13 +184,63 @@ func (stats PcStatusList) FormatJson() {
 	fmt.Println("")
 }
 
+func (stats PcStatusList) FormatJSONEnvelope() {
+	if err := pcstats.WriteJSONEnvelope(os.Stdout, stats); err != nil {
+		log.Fatalf("JSON output failed: %s\n", err)
+	}
+}
+
+func (stats PcStatusList) FormatNDJSON() {
+	if err := pcstats.WriteNDJSON(os.Stdout, stats); err != nil {
+		log.Fatalf("NDJSON output failed: %s\n", err)
+	}
+}
+
+func (stats PcStatusList) FormatJSONGzip() {
+	if err := pcstats.WriteJSONGzip(os.Stdout, stats); err != nil {
+		log.Fatalf("JSON output failed: %s\n", err)
+	}
+}
+
+func (stats PcStatusList) FormatNDJSONGzip() {
+	if err := pcstats.WriteNDJSONGzip(os.Stdout, stats); err != nil {
+		log.Fatalf("NDJSON output failed: %s\n", err)
+	}
+}
+
+func (stats PcStatusList) FormatYAML() {
+	if err := pcstats.WriteYAML(os.Stdout, stats); err != nil {
+		log.Fatalf("YAML output failed: %s\n", err)
+	}
+}
+
+func (stats PcStatusList) FormatCSV(opts pcstats.CSVOptions) {
+	if err := pcstats.WriteCSV(os.Stdout, stats, opts); err != nil {
+		log.Fatalf("CSV formatting failed: %s\n", err)
+	}
+}
+
+// displayName returns the name of the file in the formats without the
+// columns of the annotations, followed by the relation name and the direct
+// io mark when they are set.
+func displayName(pcs pcstats.PcStatus) string {
+	name := pcs.Name
+	if pcs.RelName != "" {
+		name += " (" + pcs.RelName + ")"
+	}
+	if pcs.DirectIO {
+		name += " (direct io)"
+	}
+	return name
+}
+
 // maxNameLen returns the len of longest filename in the stat list
 // if the bnameFlag is set, this will return the max basename len
 func (stats PcStatusList) maxNameLen() int {
 	var maxName int
 	for _, pcs := range stats {
-		if len(pcs.Name) > maxName {
-			maxName = len(pcs.Name)
+		if name := displayName(pcs); len(name) > maxName {
+			maxName = len(name)
 		}
 	}
 
@@ -171,6 +250,14 @@ func (stats PcStatusList) maxNameLen() int {
 	return maxName
 }
 
+// percent returns the percentage of cached pages, 0 when there is no page.
+func percent(cached, pages int64) float64 {
+	if pages == 0 {
+		return 0
+	}
+	return (float64(cached) / float64(pages)) * 100.00
+}
+
 // define some const unit
 // convert origin size data to a friendly readable string.
 func ConvertUnit(byteSize int64) string {
@@ -4,7 +4,10 @@ go 1.14
 
 require (
 	github.com/dustin/go-humanize v1.0.1
+	github.com/lib/pq v1.10.9
+	github.com/prometheus/client_golang v1.11.1
 	github.com/stretchr/testify v1.8.2
 	github.com/tobert/pcstat v0.0.1
 	golang.org/x/sys v0.0.0-20211116061358-0a5406a5449c
+	gopkg.in/yaml.v3 v3.0.1
 )
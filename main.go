@@ -5,17 +5,35 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"regexp"
 	"runtime"
+	"strings"
+	"time"
 
 	"github.com/dustin/go-humanize"
-	pcstat "github.com/tobert/pcstat/pkg"
+	_ "github.com/lib/pq"
+
+	"github.com/rfyiamcool/pgcacher/pkg/pcstats"
 )
 
 type option struct {
-	pid, worker, depth, limit             int
-	top, terse, json, unicode             bool
-	plain, bname                          bool
+	pid, worker, depth, limit, sample     int
+	top, terse, json, unicode, table, csv bool
+	plain, bname, evict, warm, dependents bool
+	relationOnly, ndjson, agent, groupDB  bool
+	followSymlinks, doubleBuffered, yaml  bool
+	envelope, relName, noAtime, gzip      bool
+	physical, invert, prewarm, relPages   bool
+	directIO                              bool
+	excludeRegex                          string
 	leastSize, excludeFiles, includeFiles string
+	promListen, dsn, relations, sortBy    string
+	remote, offset, length, maxSize       string
+	warmMinAvailable, save, load          string
+	sslMode, sslRootCert, sslCert, sslKey string
+	promInterval                          time.Duration
+	warnBelow, critBelow                  float64
+	perFile                               bool
 }
 
 var globalOption = new(option)
@@ -26,36 +44,144 @@ func init() {
 	flag.IntVar(&globalOption.limit, "limit", 500, "limit the number of files displayed")
 	flag.BoolVar(&globalOption.top, "top", false, "scan the open files of all processes, show the top few files that occupy the most memory space in the page cache.")
 	flag.IntVar(&globalOption.depth, "depth", 0, "set the depth of dirs to scan")
+	flag.BoolVar(&globalOption.followSymlinks, "follow-symlinks", false, "follow the symlinked dirs when scanning the dirs, such as the tablespaces of pg_tblspc")
 	flag.IntVar(&globalOption.worker, "worker", 2, "concurrency workers")
 	flag.StringVar(&globalOption.leastSize, "least-size", "0mb", "ignore files smaller than the lastSize, such as 10MB and 15GB")
+	flag.StringVar(&globalOption.maxSize, "max-size", "0", "skip files larger than the maxSize without mapping them, such as 1GB, 0 means no limit")
+	flag.Float64Var(&globalOption.warnBelow, "warn-below", 0, "only print a summary and exit 1 when the cached percent of all the files is below it, or 3 when no file could be scanned, for nagios")
+	flag.Float64Var(&globalOption.critBelow, "crit-below", 0, "only print a summary and exit 2 when the cached percent of all the files is below it, or 3 when no file could be scanned, for nagios")
+	flag.BoolVar(&globalOption.perFile, "per-file", false, "check -warn-below and -crit-below by the least cached file rather than all the files")
+	flag.BoolVar(&globalOption.invert, "invert", false, "show the byte ranges of the files which are not cached, such as to warm them")
+	flag.BoolVar(&globalOption.physical, "physical", false, "compute the percent against the physical size on the disk, for the compressed filesystems such as zfs and btrfs")
+	flag.BoolVar(&globalOption.noAtime, "noatime", false, "open files with O_NOATIME to not update their atime, linux only")
+	flag.IntVar(&globalOption.sample, "sample", 0, "only mincore 1 of every N windows of 1MB and extrapolate, faster but approximate for huge relations")
+	flag.StringVar(&globalOption.offset, "offset", "0", "only scan the range of the files from the offset, such as '512MB' of a huge segment")
+	flag.StringVar(&globalOption.length, "length", "0", "only scan the length bytes of the files from the offset, such as '64MB', 0 means up to the end")
 	flag.StringVar(&globalOption.excludeFiles, "exclude-files", "", "exclude the specified files by wildcard, such as 'a*c?d' and '*xiaorui*,rfyiamcool'")
+	flag.StringVar(&globalOption.excludeRegex, "exclude-regex", "", "exclude the files whose path matches the regexp, such as '_(fsm|vm)$'")
 	flag.StringVar(&globalOption.includeFiles, "include-files", "", "only include the specified files by wildcard, such as 'a*c?d' and '*xiaorui?cc,rfyiamcool'")
+	flag.BoolVar(&globalOption.relationOnly, "relation-only", false, "only include the data files of the postgresql relations, skip pg_wal, configs and others")
+	flag.BoolVar(&globalOption.evict, "evict", false, "drop the pages of the files from the page cache before showing the stats")
+	flag.BoolVar(&globalOption.warm, "warm", false, "load the files into the page cache before showing the stats")
+	flag.StringVar(&globalOption.warmMinAvailable, "warm-min-available", "0", "stop warming when the available memory of /proc/meminfo would drop below it, such as 2GB")
 
 	// show params
 	flag.BoolVar(&globalOption.terse, "terse", false, "show terse output")
 	flag.BoolVar(&globalOption.json, "json", false, "return data in JSON format")
+	flag.BoolVar(&globalOption.envelope, "envelope", false, "wrap the JSON output in an object with the version of the fields, the time generated and the host info")
+	flag.StringVar(&globalOption.save, "save", "", "also save the scan as a snapshot to the file, to report it again by -load")
+	flag.StringVar(&globalOption.load, "load", "", "report the snapshot of -save from the file instead of scanning")
+	flag.BoolVar(&globalOption.gzip, "gzip", false, "gzip the output of -json or -ndjson")
+	flag.BoolVar(&globalOption.ndjson, "ndjson", false, "return data in newline-delimited JSON, one file per line")
+	flag.BoolVar(&globalOption.yaml, "yaml", false, "return data in YAML format")
+	flag.BoolVar(&globalOption.csv, "csv", false, "return data in CSV format")
 	flag.BoolVar(&globalOption.unicode, "unicode", false, "return data with unicode box characters")
 	flag.BoolVar(&globalOption.plain, "plain", false, "return data with no box characters")
+	flag.BoolVar(&globalOption.table, "table", false, "return data as an aligned table with percent bars")
+	flag.StringVar(&globalOption.sortBy, "sort", "percent", "sort the rows of the table output by name, percent or size")
+	flag.BoolVar(&globalOption.groupDB, "group-db", false, "group the files by the postgresql database with subtotals, the names of databases are resolved with -dsn")
 	flag.BoolVar(&globalOption.bname, "bname", false, "convert paths to basename to narrow the output")
+
+	// postgresql params
+	flag.StringVar(&globalOption.dsn, "dsn", "", "the connection string of postgresql, such as 'host=/var/run/postgresql dbname=app', default to the local socket and the PG* env")
+	flag.StringVar(&globalOption.sslMode, "sslmode", "", "the sslmode to connect to postgresql over tcp, such as require and verify-full, default to PGSSLMODE")
+	flag.StringVar(&globalOption.sslRootCert, "sslrootcert", "", "the CA certificate file to verify the server with verify-ca and verify-full")
+	flag.StringVar(&globalOption.sslCert, "sslcert", "", "the client certificate file")
+	flag.StringVar(&globalOption.sslKey, "sslkey", "", "the private key file of the client certificate")
+	flag.StringVar(&globalOption.relations, "relations", "", "show the files of the postgresql relations, such as 'public.orders,public.users'")
+	flag.BoolVar(&globalOption.doubleBuffered, "double-buffered", false, "show the blocks of shared_buffers which are also in the page cache, needs the pg_buffercache extension")
+	flag.BoolVar(&globalOption.relName, "relname", false, "show the names of the relations of the files, such as public.orders, resolved in the database of -dsn")
+	flag.BoolVar(&globalOption.prewarm, "prewarm", false, "load the relations of -relations into shared_buffers by pg_prewarm before the scan")
+	flag.BoolVar(&globalOption.relPages, "relpages", false, "add relpages of pg_class of the relations and the cached blocks against it to the JSON and YAML output, resolved in the database of -dsn")
+	flag.BoolVar(&globalOption.directIO, "directio", false, "mark the files read by the server with O_DIRECT by debug_io_direct, which bypass the page cache, resolved by -dsn")
+	flag.BoolVar(&globalOption.dependents, "dependents", false, "also show the files of the indexes and TOAST of the relations")
+
+	// prometheus params
+	flag.StringVar(&globalOption.promListen, "prom-listen", "", "serve the stats as prometheus metrics on the address, such as ':9100'")
+	flag.DurationVar(&globalOption.promInterval, "prom-interval", 15*time.Second, "the interval to rescan the files for the prometheus metrics")
+
+	// remote params
+	flag.StringVar(&globalOption.remote, "remote", "", "scan the files on the remote host over ssh, such as 'postgres@db1', or the percent of the files on every host of 'db1,db2,db3', pgcacher must be in the PATH of the remote")
+	flag.BoolVar(&globalOption.agent, "agent", false, "serve the scan requests of -remote on stdin and stdout")
 }
 
 func main() {
 	// prepare phase
 	flag.Parse()
-	if runtime.GOOS != "linux" {
-		log.Fatalf("pgcacher only support running on Linux !!!")
+	if globalOption.remote == "" && globalOption.load == "" && runtime.GOOS != "linux" && runtime.GOOS != "darwin" && runtime.GOOS != "freebsd" {
+		log.Fatalf("pgcacher only support running on Linux, Darwin and FreeBSD !!!")
+	}
+	if runtime.GOOS != "linux" && (globalOption.top || globalOption.pid != 0) {
+		log.Fatalf("the top and pid params need the procfs of Linux !!!")
 	}
 	leastSize, _ := humanize.ParseBytes(globalOption.leastSize)
+	maxSize, err := humanize.ParseBytes(globalOption.maxSize)
+	if err != nil {
+		log.Fatalf("invalid max-size, err: %v", err)
+	}
+	warmMinAvailable, err := humanize.ParseBytes(globalOption.warmMinAvailable)
+	if err != nil {
+		log.Fatalf("invalid warm-min-available, err: %v", err)
+	}
+	offset, err := humanize.ParseBytes(globalOption.offset)
+	if err != nil {
+		log.Fatalf("invalid offset, err: %v", err)
+	}
+	length, err := humanize.ParseBytes(globalOption.length)
+	if err != nil {
+		log.Fatalf("invalid length, err: %v", err)
+	}
+
+	var excludeRegex *regexp.Regexp
+	if globalOption.excludeRegex != "" {
+		var err error
+		if excludeRegex, err = regexp.Compile(globalOption.excludeRegex); err != nil {
+			log.Fatalf("invalid exclude-regex, err: %v", err)
+		}
+	}
+
+	if globalOption.agent {
+		if err := pcstats.ServeAgent(os.Stdin, os.Stdout, globalOption.worker); err != nil {
+			log.Fatalf("agent failed, err: %v", err)
+		}
+		os.Exit(0)
+	}
 
 	// running phase
 	files := flag.Args()
-	files = walkDirs(files, globalOption.depth)
+	files = readStdinFiles(files)
+	if globalOption.remote == "" {
+		files = walkDirs(files, globalOption.depth, globalOption.followSymlinks)
+	}
 
 	// init pgcacher obj
 	pg := pgcacher{
-		files:     files,
-		leastSize: int64(leastSize),
-		option:    globalOption,
+		files:        files,
+		leastSize:    int64(leastSize),
+		maxSize:      int64(maxSize),
+		warmMinAvail: int64(warmMinAvailable),
+		offset:       int64(offset),
+		length:       int64(length),
+		excludeRegex: excludeRegex,
+		option:       globalOption,
+	}
+
+	if strings.Contains(globalOption.remote, ",") {
+		pg.filterFiles()
+		pg.showFanOut()
+		os.Exit(0)
+	}
+
+	if globalOption.remote != "" {
+		pg.filterFiles()
+		stats := pg.getRemotePageCacheStats()
+		pg.output(stats, pg.option.limit)
+		os.Exit(0)
+	}
+
+	if globalOption.load != "" {
+		pg.output(pg.loadSnapshot(), pg.option.limit)
+		os.Exit(0)
 	}
 
 	if globalOption.top {
@@ -67,6 +193,15 @@ func main() {
 		pg.appendProcessFiles(globalOption.pid)
 	}
 
+	if globalOption.doubleBuffered {
+		pg.showDoubleBuffered()
+		os.Exit(0)
+	}
+
+	if globalOption.relations != "" {
+		pg.appendRelationFiles()
+	}
+
 	if len(pg.files) == 0 {
 		fmt.Println("the files is null ???")
 		flag.Usage()
@@ -74,14 +209,32 @@ func main() {
 	}
 
 	pg.filterFiles()
+	if globalOption.promListen != "" {
+		pg.servePrometheus()
+		os.Exit(0)
+	}
+
+	if globalOption.invert {
+		pg.showUncachedRanges()
+		os.Exit(0)
+	}
+
+	if globalOption.evict {
+		pg.evictFiles()
+	}
+	if globalOption.warm {
+		pg.warmFiles()
+	}
+
 	stats := pg.getPageCacheStats()
+	if globalOption.save != "" {
+		pg.saveSnapshot(stats)
+	}
+	if globalOption.warnBelow != 0 || globalOption.critBelow != 0 {
+		os.Exit(int(pg.check(stats)))
+	}
 	pg.output(stats, pg.option.limit)
 
 	// invalid function, just make a reference relationship with pcstat
 	invalidCall()
 }
-
-func invalidCall() {
-	pcstat.SwitchMountNs(os.Getegid())
-	pcstat.GetPcStatus(os.Args[0])
-}
@@ -0,0 +1,16 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+
+	pcstat "github.com/tobert/pcstat/pkg"
+)
+
+// invalid function, just make a reference relationship with pcstat
+func invalidCall() {
+	pcstat.SwitchMountNs(os.Getegid())
+	pcstat.GetPcStatus(os.Args[0])
+}
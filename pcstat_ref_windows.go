@@ -0,0 +1,4 @@
+package main
+
+// upstream pcstat doesn't build on windows, nothing to reference.
+func invalidCall() {}
@@ -2,38 +2,65 @@ package main
 
 import (
 	"bufio"
+	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/fs"
-	"io/ioutil"
 	"log"
+	"net/http"
 	"os"
+	"os/exec"
 	"path"
+	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
 
 	"github.com/rfyiamcool/pgcacher/pkg/pcstats"
+	"github.com/rfyiamcool/pgcacher/pkg/pcstats/promexport"
+	"github.com/rfyiamcool/pgcacher/pkg/pgutils"
 	"github.com/rfyiamcool/pgcacher/pkg/psutils"
 )
 
 type emptyNull struct{}
 
 type pgcacher struct {
-	files     []string
-	leastSize int64
-	option    *option
+	files        []string
+	leastSize    int64
+	maxSize      int64
+	warmMinAvail int64
+	offset       int64
+	length       int64
+	excludeRegex *regexp.Regexp
+	option       *option
 }
 
+// ignoreFile checks the excludes before the includes, the excludes win.
 func (pg *pgcacher) ignoreFile(file string) bool {
 	if pg.option.excludeFiles != "" && wildcardMatch(file, pg.option.excludeFiles) {
 		return true
 	}
 
+	if pg.excludeRegex != nil && pg.excludeRegex.MatchString(file) {
+		return true
+	}
+
 	if pg.option.includeFiles != "" && !wildcardMatch(file, pg.option.includeFiles) {
 		return true
 	}
 
+	if pg.option.relationOnly && !pgutils.IsRelationFile(file) {
+		return true
+	}
+
 	return false
 }
 
@@ -59,6 +86,156 @@ func (pg *pgcacher) appendProcessFiles(pid int) {
 	pg.files = append(pg.files, pg.getProcessFiles(pid)...)
 }
 
+func (pg *pgcacher) appendRelationFiles() {
+	conn := pg.connect()
+	defer conn.Close()
+
+	for _, relname := range strings.Split(pg.option.relations, ",") {
+		relname = strings.TrimSpace(relname)
+		if relname == "" {
+			continue
+		}
+
+		if pg.option.prewarm {
+			if err := pgutils.PrewarmRelation(conn, relname); err != nil {
+				log.Printf("could not prewarm relation %q, err: %v", relname, err)
+			}
+		}
+
+		files, err := pg.resolveRelation(conn, relname)
+		if err != nil {
+			log.Printf("could not resolve relation %q, err: %v", relname, err)
+			continue
+		}
+		pg.files = append(pg.files, files...)
+	}
+}
+
+func (pg *pgcacher) resolveRelation(conn *sql.DB, relname string) ([]string, error) {
+	if !pg.option.dependents {
+		return pgutils.ResolveRelationFiles(conn, "", relname)
+	}
+
+	roles, err := pgutils.ResolveRelationWithDependents(conn, "", relname)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, rfiles := range roles {
+		files = append(files, rfiles...)
+	}
+	return files, nil
+}
+
+func (pg *pgcacher) showDoubleBuffered() {
+	conn := pg.connect()
+	defer conn.Close()
+
+	overlaps, err := pgutils.DoubleBuffered(conn)
+	if err != nil {
+		log.Fatalf("failed to check the double buffering, err: %v", err)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "RELATION\tFORK\tBUFFERED\tDOUBLE BUFFERED\tPERCENT")
+	for _, ov := range overlaps {
+		if ov.Error != "" {
+			log.Printf("skipping %s of %s, err: %s", ov.Fork, ov.Relation, ov.Error)
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%.2f%%\n",
+			ov.Relation, ov.Fork, ov.Buffered, ov.DoubleBuffered, percent(int64(ov.DoubleBuffered), int64(ov.Buffered)))
+	}
+	tw.Flush()
+}
+
+// databaseNames returns the names of databases by their oid with -dsn,
+// otherwise the databases are shown as oids.
+func (pg *pgcacher) databaseNames() map[pgutils.Oid]string {
+	if pg.option.dsn == "" {
+		return nil
+	}
+
+	conn := pg.connect()
+	defer conn.Close()
+
+	names, err := pgutils.DatabaseNames(conn)
+	if err != nil {
+		log.Printf("could not get the names of databases, err: %v", err)
+	}
+	return names
+}
+
+// annotateRelNames sets the relation names of the files, the table and CSV
+// show them in a column of their own, the text formats after the file name.
+func (pg *pgcacher) annotateRelNames(stats PcStatusList) {
+	conn := pg.connect()
+	defer conn.Close()
+
+	names, err := pgutils.RelationNames(conn)
+	if err != nil {
+		log.Printf("could not get the names of relations, err: %v", err)
+		return
+	}
+	pgutils.AnnotateRelNames(stats, names)
+}
+
+// annotateRelPages sets the relpages of the relations of the files, only the
+// JSON and YAML show them.
+func (pg *pgcacher) annotateRelPages(stats PcStatusList) {
+	conn := pg.connect()
+	defer conn.Close()
+
+	pages, err := pgutils.RelationPages(conn)
+	if err != nil {
+		log.Printf("could not get the relpages of relations, err: %v", err)
+		return
+	}
+	pgutils.AnnotateRelPages(stats, pages)
+}
+
+// annotateDirectIO marks the files read with O_DIRECT by the server, the
+// table and CSV show it in a column of its own, the text formats after the
+// file name.
+func (pg *pgcacher) annotateDirectIO(stats PcStatusList) {
+	conn := pg.connect()
+	defer conn.Close()
+
+	dio, err := pgutils.DirectIOSettings(conn)
+	if err != nil {
+		log.Printf("could not get the direct io of the server, err: %v", err)
+		return
+	}
+	pgutils.AnnotateDirectIO(stats, dio)
+}
+
+func (pg *pgcacher) connect() *sql.DB {
+	var (
+		conn *sql.DB
+		err  error
+	)
+
+	opts := pgutils.ConnOptions{
+		SSLMode:     pg.option.sslMode,
+		SSLRootCert: pg.option.sslRootCert,
+		SSLCert:     pg.option.sslCert,
+		SSLKey:      pg.option.sslKey,
+	}
+
+	// connect by the local socket and the PG* env without the dsn, the ssl
+	// params override the ones of the dsn.
+	if pg.option.dsn == "" {
+		conn, err = pgutils.Connect("postgres", opts)
+	} else if err = opts.Validate(); err == nil {
+		conn, err = sql.Open("postgres", pgutils.WithSSL(pg.option.dsn, opts))
+	}
+	if err != nil {
+		log.Fatalf("failed to connect to postgresql, err: %v", err)
+	}
+	return conn
+}
+
 func (pg *pgcacher) getProcessFiles(pid int) []string {
 	// switch mount namespace for container.
 	pcstats.SwitchMountNs(pg.option.pid)
@@ -165,6 +342,30 @@ func (pg *pgcacher) getProcessFdFiles(pid int) []string {
 	return out
 }
 
+func (pg *pgcacher) evictFiles() {
+	for _, fname := range pg.files {
+		if err := pcstats.EvictFile(fname); err != nil {
+			log.Printf("could not evict %q: %v", fname, err)
+		}
+	}
+}
+
+// warmFiles stops at the first file which can't be warmed for the memory,
+// the available memory is checked again before every file.
+func (pg *pgcacher) warmFiles() {
+	opt := pcstats.WarmOptions{MinAvailable: pg.warmMinAvail}
+	for _, fname := range pg.files {
+		_, err := pcstats.WarmFile(fname, opt)
+		if err == pcstats.ErrMemoryLow {
+			log.Printf("stop warming at %q: %v", fname, err)
+			return
+		}
+		if err != nil {
+			log.Printf("could not warm %q: %v", fname, err)
+		}
+	}
+}
+
 var errLessThanSize = errors.New("the file size is less than the leastSize")
 
 func (pg *pgcacher) getPageCacheStats() PcStatusList {
@@ -173,6 +374,10 @@ func (pg *pgcacher) getPageCacheStats() PcStatusList {
 		wg = sync.WaitGroup{}
 
 		stats = make(PcStatusList, 0, len(pg.files))
+
+		// denied counts the files which can't be read for the permission,
+		// they are summarized once rather than logged one by one.
+		denied int32
 	)
 
 	// fill files to queue.
@@ -194,8 +399,19 @@ func (pg *pgcacher) getPageCacheStats() PcStatusList {
 	}
 
 	analyse := func(fname string) {
-		status, err := pcstats.GetPcStatus(fname, ignoreFunc)
-		if err == errLessThanSize {
+		status, err := pcstats.GetPcStatus(fname, ignoreFunc, pcstats.Options{
+			MaxFileSize:     pg.maxSize,
+			Offset:          pg.offset,
+			Length:          pg.length,
+			Sample:          pg.option.sample,
+			NoAtime:         pg.option.noAtime,
+			PhysicalPercent: pg.option.physical,
+		})
+		if err == errLessThanSize || status.Skipped {
+			return
+		}
+		if errors.Is(err, pcstats.ErrPermission) {
+			atomic.AddInt32(&denied, 1)
 			return
 		}
 		if err != nil {
@@ -227,6 +443,203 @@ func (pg *pgcacher) getPageCacheStats() PcStatusList {
 	}
 	wg.Wait()
 
+	if denied > 0 {
+		log.Printf("%d files skipped: %s", denied, pcstats.SkipPermission)
+	}
+
+	sort.Sort(PcStatusList(stats))
+	return stats
+}
+
+// getRemotePageCacheStats scans the files on the remote host by running
+// `pgcacher -agent` over ssh.
+func (pg *pgcacher) getRemotePageCacheStats() PcStatusList {
+	cmd := exec.Command("ssh", pg.option.remote, "pgcacher", "-agent", "-worker", strconv.Itoa(pg.option.worker))
+	cmd.Stderr = os.Stderr
+
+	conn, err := pcstats.CommandTransport(cmd)
+	if err != nil {
+		log.Fatalf("failed to connect to %s, err: %v", pg.option.remote, err)
+	}
+
+	stats, err := pcstats.RemoteScan(conn, pg.files)
+	if err != nil {
+		log.Fatalf("failed to scan the files on %s, err: %v", pg.option.remote, err)
+	}
+
+	out := make(PcStatusList, 0, len(stats))
+	for _, status := range stats {
+		if status.Error != "" {
+			log.Printf("skipping %q on %s: %s", status.Name, pg.option.remote, status.Error)
+			continue
+		}
+		if status.Size < pg.leastSize {
+			continue
+		}
+		if pg.option.bname {
+			status.Name = path.Base(status.Name)
+		}
+		out = append(out, status)
+	}
+
+	sort.Sort(out)
+	return out
+}
+
+// showFanOut scans the files on all the comma separated hosts of -remote at
+// once, and prints the percent of every file by the host, such as to check
+// a replica is warm before promoting it.
+func (pg *pgcacher) showFanOut() {
+	hosts := strings.Split(pg.option.remote, ",")
+	dial := func(host string) (io.ReadWriteCloser, error) {
+		cmd := exec.Command("ssh", host, "pgcacher", "-agent", "-worker", strconv.Itoa(pg.option.worker))
+		cmd.Stderr = os.Stderr
+		return pcstats.CommandTransport(cmd)
+	}
+
+	results := pcstats.FanOutScan(hosts, dial, pg.files)
+	for _, host := range hosts {
+		if err := results[host].Err; err != nil {
+			log.Printf("skipping host %s, err: %v", host, err)
+		}
+	}
+	m := pcstats.MergeHostResults(results)
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "NAME\t%s\n", strings.ToUpper(strings.Join(m.Hosts, "\t")))
+	for _, name := range m.Names {
+		row := make([]string, 0, len(m.Hosts))
+		for _, host := range m.Hosts {
+			if msg, ok := m.Errors[name][host]; ok {
+				log.Printf("could not scan %q on %s: %s", name, host, msg)
+				row = append(row, "error")
+				continue
+			}
+			percent, ok := m.Percent[name][host]
+			if !ok {
+				row = append(row, "-")
+				continue
+			}
+			row = append(row, fmt.Sprintf("%.2f%%", percent))
+		}
+		if pg.option.bname {
+			name = path.Base(name)
+		}
+		fmt.Fprintf(tw, "%s\t%s\n", name, strings.Join(row, "\t"))
+	}
+	tw.Flush()
+}
+
+// showUncachedRanges prints the ranges of the uncached pages of every file,
+// in JSON with -json.
+func (pg *pgcacher) showUncachedRanges() {
+	type fileRanges struct {
+		Name   string              `json:"filename"`
+		Ranges []pcstats.ByteRange `json:"ranges"`
+	}
+
+	var out []fileRanges
+	for _, fname := range pg.files {
+		ranges, err := uncachedRanges(fname)
+		if err != nil {
+			log.Printf("skipping %q: %v", fname, err)
+			continue
+		}
+		if pg.option.bname {
+			fname = path.Base(fname)
+		}
+		out = append(out, fileRanges{Name: fname, Ranges: ranges})
+	}
+
+	if pg.option.json {
+		b, err := json.Marshal(out)
+		if err != nil {
+			log.Fatalf("JSON formatting failed: %s\n", err)
+		}
+		os.Stdout.Write(b)
+		fmt.Println("")
+		return
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tOFFSET\tLENGTH")
+	for _, fr := range out {
+		for _, r := range fr.Ranges {
+			fmt.Fprintf(tw, "%s\t%d\t%d\n", fr.Name, r.Offset, r.Length)
+		}
+	}
+	tw.Flush()
+}
+
+func uncachedRanges(fname string) ([]pcstats.ByteRange, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	finfo, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return pcstats.UncachedRanges(f, finfo.Size())
+}
+
+// check evaluates the stats by -warn-below and -crit-below, and prints the
+// one line summary of the nagios plugins.
+func (pg *pgcacher) check(stats PcStatusList) pcstats.Severity {
+	warn, crit := pg.option.warnBelow, pg.option.critBelow
+	total := pcstats.Totals(stats)
+
+	severity := pcstats.Evaluate(stats, warn, crit)
+	detail := fmt.Sprintf("%.2f%% cached of %d files", total.Percent, len(stats))
+	if pg.option.perFile {
+		severity = pcstats.EvaluateMin(stats, warn, crit)
+		if len(stats) != 0 {
+			coldest := stats[0]
+			for _, status := range stats {
+				if status.Percent < coldest.Percent {
+					coldest = status
+				}
+			}
+			detail = fmt.Sprintf("least cached %s at %.2f%% of %d files", coldest.Name, coldest.Percent, len(stats))
+		}
+	}
+	if severity == pcstats.SeverityUnknown {
+		detail = fmt.Sprintf("none of %d files scanned", len(stats))
+	}
+
+	fmt.Printf("PGCACHER %s - %s | percent=%.2f%%;%g;%g\n", severity, detail, total.Percent, warn, crit)
+	return severity
+}
+
+// saveSnapshot writes the stats to the file of -save.
+func (pg *pgcacher) saveSnapshot(stats PcStatusList) {
+	f, err := os.Create(pg.option.save)
+	if err != nil {
+		log.Fatalf("could not create the snapshot, err: %v", err)
+	}
+	if err := pcstats.SaveSnapshot(f, stats); err != nil {
+		log.Fatalf("could not save the snapshot, err: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		log.Fatalf("could not save the snapshot, err: %v", err)
+	}
+}
+
+// loadSnapshot reads the stats from the file of -load, sorted as a scan.
+func (pg *pgcacher) loadSnapshot() PcStatusList {
+	f, err := os.Open(pg.option.load)
+	if err != nil {
+		log.Fatalf("could not open the snapshot, err: %v", err)
+	}
+	defer f.Close()
+
+	stats, err := pcstats.LoadSnapshot(f)
+	if err != nil {
+		log.Fatalf("could not load the snapshot, err: %v", err)
+	}
+
 	sort.Sort(PcStatusList(stats))
 	return stats
 }
@@ -235,14 +648,43 @@ func (pg *pgcacher) output(stats PcStatusList, limit int) {
 	limit = min(len(stats), limit)
 	stats = stats[:limit]
 
-	if pg.option.json {
+	if pg.option.relName {
+		pg.annotateRelNames(stats)
+	}
+	if pg.option.relPages {
+		pg.annotateRelPages(stats)
+	}
+	if pg.option.directIO {
+		pg.annotateDirectIO(stats)
+	}
+
+	if pg.option.json && pg.option.envelope {
+		stats.FormatJSONEnvelope()
+	} else if pg.option.json && pg.option.gzip {
+		stats.FormatJSONGzip()
+	} else if pg.option.json {
 		stats.FormatJson()
+	} else if pg.option.ndjson && pg.option.gzip {
+		stats.FormatNDJSONGzip()
+	} else if pg.option.ndjson {
+		stats.FormatNDJSON()
+	} else if pg.option.yaml {
+		stats.FormatYAML()
+	} else if pg.option.csv {
+		stats.FormatCSV(pcstats.CSVOptions{
+			RelName:  pg.option.relName,
+			DirectIO: pg.option.directIO,
+		})
 	} else if pg.option.terse {
 		stats.FormatTerse()
 	} else if pg.option.unicode {
 		stats.FormatUnicode()
 	} else if pg.option.plain {
 		stats.FormatPlain()
+	} else if pg.option.groupDB {
+		stats.FormatGrouped(pg.tableOptions(), pg.databaseNames())
+	} else if pg.option.table {
+		stats.FormatTable(pg.tableOptions())
 	} else {
 		stats.FormatText()
 	}
@@ -303,6 +745,24 @@ func (pg *pgcacher) handleTop() {
 	pg.output(stats, pg.option.limit)
 }
 
+func (pg *pgcacher) servePrometheus() {
+	reg := prometheus.NewRegistry()
+	exporter, err := promexport.New(reg, nil)
+	if err != nil {
+		log.Fatalf("failed to create prometheus exporter, err: %v", err)
+	}
+
+	go func() {
+		for {
+			exporter.Update(pg.getPageCacheStats())
+			time.Sleep(pg.option.promInterval)
+		}
+	}()
+
+	http.Handle("/metrics", promexport.Handler(reg))
+	log.Fatal(http.ListenAndServe(pg.option.promListen, nil))
+}
+
 func min(x, y int) int {
 	if x < y {
 		return x
@@ -360,7 +820,28 @@ func wildcardMatch(s string, p string) bool {
 	return isMatchingMatrix[lenInput][lenPattern]
 }
 
-func walkDirs(dirs []string, maxDepth int) []string {
+// readStdinFiles replaces the `-` arg with the files listed in stdin.
+func readStdinFiles(files []string) []string {
+	var out []string
+	for _, file := range files {
+		if file != "-" {
+			out = append(out, file)
+			continue
+		}
+
+		stdinFiles, err := pcstats.ReadFileList(os.Stdin)
+		if err != nil {
+			log.Fatalf("failed to read files from stdin, err: %v", err)
+		}
+		out = append(out, stdinFiles...)
+	}
+	return out
+}
+
+// walkDirs expands the dirs into their files up to maxDepth, the symlinked
+// dirs under them, such as the tablespaces of pg_tblspc, are skipped unless
+// followSymlinks, the dirs given are always followed.
+func walkDirs(dirs []string, maxDepth int, followSymlinks bool) []string {
 	if len(dirs) == 0 {
 		return dirs
 	}
@@ -374,6 +855,7 @@ func walkDirs(dirs []string, maxDepth int) []string {
 		}
 
 		fs, err := fi.Stat()
+		fi.Close()
 		if err != nil {
 			files = append(files, dir)
 			continue
@@ -381,7 +863,10 @@ func walkDirs(dirs []string, maxDepth int) []string {
 
 		// is dir
 		if fs.IsDir() {
-			files = append(files, walkDir(dir, 0, maxDepth)...)
+			if maxDepth > 0 {
+				dfiles, _ := pcstats.WalkFiles(dir, pcstats.ScanOptions{MaxDepth: maxDepth, FollowSymlinks: followSymlinks})
+				files = append(files, dfiles...)
+			}
 			continue
 		}
 
@@ -391,27 +876,3 @@ func walkDirs(dirs []string, maxDepth int) []string {
 
 	return files
 }
-
-func walkDir(dir string, depth int, maxDepth int) []string {
-	if depth >= maxDepth {
-		return nil
-	}
-
-	var files []string
-	ofiles, err := ioutil.ReadDir(dir)
-	if err != nil {
-		return nil
-	}
-
-	for _, file := range ofiles {
-		curdir := path.Join(dir, file.Name())
-		if file.IsDir() {
-			files = append(files, walkDir(curdir, depth+1, maxDepth)...)
-			continue
-		}
-
-		files = append(files, curdir)
-	}
-
-	return files
-}
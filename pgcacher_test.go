@@ -1,7 +1,13 @@
+//go:build !windows
+// +build !windows
+
 package main
 
 import (
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"sort"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -23,3 +29,29 @@ func TestNull(t *testing.T) {
 
 	t.Logf("%s %v", stat.Name, stat.Cached)
 }
+
+func TestWalkDirsSymlinks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pgcacher")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	tblspc := filepath.Join(dir, "tblspc")
+	assert.Nil(t, os.MkdirAll(filepath.Join(dir, "data", "pg_tblspc"), 0755))
+	assert.Nil(t, os.MkdirAll(tblspc, 0755))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "data", "16384"), nil, 0644))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(tblspc, "16385"), nil, 0644))
+	assert.Nil(t, os.Symlink(tblspc, filepath.Join(dir, "data", "pg_tblspc", "16400")))
+	// a loop back to the data dir.
+	assert.Nil(t, os.Symlink(filepath.Join(dir, "data"), filepath.Join(tblspc, "loop")))
+
+	data := filepath.Join(dir, "data")
+	files := walkDirs([]string{data}, 10, false)
+	assert.Equal(t, []string{filepath.Join(data, "16384")}, files)
+
+	files = walkDirs([]string{data}, 10, true)
+	sort.Strings(files)
+	assert.Equal(t, []string{
+		filepath.Join(data, "16384"),
+		filepath.Join(data, "pg_tblspc", "16400", "16385"),
+	}, files)
+}
@@ -0,0 +1,77 @@
+package pcstats
+
+// TotalName is the name of the status returned by Totals.
+const TotalName = "TOTAL"
+
+// Totals sums the size and pages of all the statuses into one named TOTAL,
+// the percent is recomputed from the summed pages rather than averaging the
+// percent of files. the entries which were never scanned, such as the ones
+// with errors of GetPcStatusBatch, have no Timestamp and are skipped.
+func Totals(statuses []PcStatus) PcStatus {
+	scanned := make([]PcStatus, 0, len(statuses))
+	for _, pcs := range statuses {
+		if pcs.Timestamp.IsZero() {
+			continue
+		}
+		scanned = append(scanned, pcs)
+	}
+
+	total := SumPcStatus(scanned)
+	total.Name = TotalName
+	return total
+}
+
+// WorkingSetBytes sums the CachedBytes of the statuses, the resident bytes
+// of the files such as the relations of a postgresql instance, to compare
+// with MemTotal of /proc/meminfo. the entries with errors, which have no
+// Timestamp, are skipped as in Totals.
+func WorkingSetBytes(statuses []PcStatus) int64 {
+	var total int64
+	for _, pcs := range statuses {
+		if pcs.Timestamp.IsZero() {
+			continue
+		}
+		total += pcs.CachedBytes
+	}
+	return total
+}
+
+// UnknownDatabase is the group of GroupByDatabase for the files which can't
+// be mapped to a database.
+const UnknownDatabase = "unknown"
+
+// GroupByDatabase groups the statuses by the database returned by fileToDB
+// for their names, such as pgutils.DatabaseMapper, the files mapped to ""
+// go into the UnknownDatabase group rather than being dropped.
+func GroupByDatabase(statuses []PcStatus, fileToDB func(string) string) map[string][]PcStatus {
+	groups := make(map[string][]PcStatus)
+	for _, pcs := range statuses {
+		db := fileToDB(pcs.Name)
+		if db == "" {
+			db = UnknownDatabase
+		}
+		groups[db] = append(groups[db], pcs)
+	}
+	return groups
+}
+
+// Dedup drops the statuses of the hardlinks of the files seen before, such
+// as the clones of pg_basebackup, by the device and inode, so they aren't
+// counted twice into Totals. the entries without an inode are kept.
+func Dedup(statuses []PcStatus) []PcStatus {
+	type fileKey struct{ dev, ino uint64 }
+
+	seen := make(map[fileKey]bool, len(statuses))
+	out := make([]PcStatus, 0, len(statuses))
+	for _, pcs := range statuses {
+		if pcs.Inode != 0 {
+			key := fileKey{pcs.Device, pcs.Inode}
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+		}
+		out = append(out, pcs)
+	}
+	return out
+}
@@ -0,0 +1,136 @@
+package pcstats
+
+import (
+	"fmt"
+	"strings"
+)
+
+// AssertionError is the violation of Assert, the Percent of the file is out
+// of [Min, Max].
+type AssertionError struct {
+	Name    string
+	Percent float64
+	Min     float64
+	Max     float64
+}
+
+func (e *AssertionError) Error() string {
+	return fmt.Sprintf("%s is %.2f%% cached, expected within [%.2f%%, %.2f%%]", e.Name, e.Percent, e.Min, e.Max)
+}
+
+// AssertionErrors is the violations of AssertAll, in the order of the
+// statuses.
+type AssertionErrors []*AssertionError
+
+func (errs AssertionErrors) Error() string {
+	msgs := make([]string, 0, len(errs))
+	for _, err := range errs {
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Sprintf("%d files out of the expected cached percent: %s", len(errs), strings.Join(msgs, "; "))
+}
+
+// Assert checks the Percent of the status is within [min, max], such as for
+// gating a deploy on the cache warmth after a warm-up, both bounds are
+// inclusive, so Assert(pcs, 0, 0) expects the file is fully evicted. it
+// returns an *AssertionError or nil.
+func Assert(status PcStatus, min, max float64) error {
+	if status.Percent >= min && status.Percent <= max {
+		return nil
+	}
+	return &AssertionError{Name: status.Name, Percent: status.Percent, Min: min, Max: max}
+}
+
+// AssertAll is Assert of every status, it returns AssertionErrors of all the
+// violations or nil.
+func AssertAll(statuses []PcStatus, min, max float64) error {
+	var errs AssertionErrors
+	for _, pcs := range statuses {
+		if err := Assert(pcs, min, max); err != nil {
+			errs = append(errs, err.(*AssertionError))
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// Severity is the result of Evaluate, the values are the exit codes of the
+// nagios plugins.
+type Severity int
+
+const (
+	SeverityOK      Severity = 0
+	SeverityWarn    Severity = 1
+	SeverityCrit    Severity = 2
+	SeverityUnknown Severity = 3 // no file was scanned, so there is nothing to grade
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityOK:
+		return "OK"
+	case SeverityWarn:
+		return "WARNING"
+	case SeverityCrit:
+		return "CRITICAL"
+	case SeverityUnknown:
+		return "UNKNOWN"
+	}
+	return fmt.Sprintf("UNKNOWN(%d)", int(s))
+}
+
+// Evaluate grades the cache warmth of the statuses by the Percent of their
+// Totals, SeverityCrit below crit, SeverityWarn below warn, otherwise
+// SeverityOK, such as for the checks of nagios or icinga. a threshold of 0
+// never triggers. it's SeverityUnknown when no file was scanned, such as for
+// an empty input or the entries with errors only, rather than a cold cache.
+func Evaluate(statuses []PcStatus, warn, crit float64) Severity {
+	if !anyScanned(statuses) {
+		return SeverityUnknown
+	}
+	return severityOf(Totals(statuses).Percent, warn, crit)
+}
+
+// EvaluateMin is Evaluate by the least Percent of the files rather than the
+// total, so a single cold file triggers. the entries with errors, which have
+// no Timestamp, are skipped, it's SeverityUnknown as Evaluate when all of
+// them are.
+func EvaluateMin(statuses []PcStatus, warn, crit float64) Severity {
+	if !anyScanned(statuses) {
+		return SeverityUnknown
+	}
+
+	worst := SeverityOK
+	for _, pcs := range statuses {
+		if pcs.Timestamp.IsZero() {
+			continue
+		}
+		if s := severityOf(pcs.Percent, warn, crit); s > worst {
+			worst = s
+		}
+	}
+	return worst
+}
+
+// anyScanned reports whether any of the statuses was scanned, the entries
+// with errors have no Timestamp.
+func anyScanned(statuses []PcStatus) bool {
+	for _, pcs := range statuses {
+		if !pcs.Timestamp.IsZero() {
+			return true
+		}
+	}
+	return false
+}
+
+func severityOf(percent, warn, crit float64) Severity {
+	switch {
+	case percent < crit:
+		return SeverityCrit
+	case percent < warn:
+		return SeverityWarn
+	}
+	return SeverityOK
+}
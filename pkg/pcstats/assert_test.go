@@ -0,0 +1,52 @@
+package pcstats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAssert(t *testing.T) {
+	assert.Nil(t, Assert(PcStatus{Name: "a", Percent: 90}, 90, 100))
+	assert.Nil(t, Assert(PcStatus{Name: "a"}, 0, 0))
+
+	err := Assert(PcStatus{Name: "a", Percent: 50}, 90, 100)
+	assert.Equal(t, &AssertionError{Name: "a", Percent: 50, Min: 90, Max: 100}, err)
+	assert.Equal(t, "a is 50.00% cached, expected within [90.00%, 100.00%]", err.Error())
+
+	stats := []PcStatus{{Name: "a", Percent: 95}, {Name: "b", Percent: 10}, {Name: "c", Percent: 20}}
+	assert.Nil(t, AssertAll(stats[:1], 90, 100))
+
+	err = AssertAll(stats, 90, 100)
+	errs, ok := err.(AssertionErrors)
+	assert.True(t, ok)
+	assert.Equal(t, 2, len(errs))
+	assert.Equal(t, "b", errs[0].Name)
+	assert.Equal(t, "c", errs[1].Name)
+}
+
+func TestEvaluate(t *testing.T) {
+	now := time.Now()
+	stats := []PcStatus{
+		{Name: "hot", Timestamp: now, Pages: 90, Cached: 90, Percent: 100},
+		{Name: "cold", Timestamp: now, Pages: 10, Cached: 0, Percent: 0},
+		{Name: "failed"},
+	}
+	assert.Equal(t, SeverityOK, Evaluate(stats, 80, 50))
+	assert.Equal(t, SeverityWarn, Evaluate(stats, 95, 50))
+	assert.Equal(t, SeverityCrit, Evaluate(stats, 99, 95))
+	assert.Equal(t, SeverityOK, Evaluate(stats, 0, 0))
+
+	assert.Equal(t, SeverityCrit, EvaluateMin(stats, 80, 50))
+	assert.Equal(t, SeverityOK, EvaluateMin(stats[:1], 80, 50))
+	assert.Equal(t, "WARNING", SeverityWarn.String())
+
+	// nothing scanned isn't a cold cache.
+	for _, stats := range [][]PcStatus{nil, stats[2:]} {
+		assert.Equal(t, SeverityUnknown, Evaluate(stats, 80, 50))
+		assert.Equal(t, SeverityUnknown, EvaluateMin(stats, 80, 50))
+	}
+	assert.Equal(t, "UNKNOWN", SeverityUnknown.String())
+	assert.Equal(t, 3, int(SeverityUnknown))
+}
@@ -0,0 +1,219 @@
+package pcstats
+
+import (
+	"context"
+	"os"
+	"sort"
+	"time"
+)
+
+// BatchOptions controls how GetPcStatusBatch and Scanner scan the files.
+type BatchOptions struct {
+	// Concurrency is the number of workers, which also bounds the number of
+	// files opened at the same time, default 1.
+	Concurrency int
+
+	// Filter is passed to GetPcStatus for every file, it may be nil.
+	Filter func(f *os.File) error
+
+	// Options is passed to GetPcStatus for every file.
+	Options Options
+
+	// MinPercent and MaxPercent drop the files whose Percent is out of
+	// [MinPercent, MaxPercent] from the results, MaxPercent 0 means no upper
+	// bound. the files with errors are always kept. empty files have no
+	// pages to be cached, so they are always dropped when the filter is set.
+	MinPercent float64
+	MaxPercent float64
+
+	// Throttle paces the scan, so a background audit of a huge directory
+	// doesn't become a cache pressure event itself.
+	Throttle Throttle
+
+	// OnProgress is called as each file completes, with the number of files
+	// done, the total and the file just done. the calls are serialized, so
+	// it needs no synchronization, but a slow one stalls the workers.
+	OnProgress func(done, total int, current string)
+
+	// SortByName orders the results by Name rather than the order of the
+	// input, the errors are moved along with their files.
+	SortByName bool
+
+	// IOUringPrestat stats the files by statx through io_uring before the
+	// scan, many in flight at once rather than a stat syscall per file, to
+	// reject the directories and the non-regular files before their open.
+	// it's only that prestat: the open, the fstat and the mincore of every
+	// file still run one by one in the workers, so it saves at most one
+	// syscall per file, which only shows on a huge PGDATA of small files.
+	// the opens aren't submitted to the ring, as that would open a whole
+	// ring of files at once past Concurrency. the results are the same as
+	// without it, it falls back to the usual path when io_uring isn't
+	// available, such as on the kernels before 5.6 or other platforms.
+	IOUringPrestat bool
+
+	// SkipPermissionDenied returns the files which can't be read for the
+	// permission, such as the files of PGDATA scanned by a non-superuser,
+	// as Skipped with SkipPermission and no error, rather than as the
+	// errors, see SkipCounts for the summary.
+	SkipPermissionDenied bool
+
+	// PerFileTimeout bounds the scan of every file, such as on a flaky nfs
+	// mount, a file over it fails with ErrTimeout right away. the scan is
+	// cancelled between its mincore windows, but a syscall hung in the
+	// kernel can't be, so the scan is left to finish in the background,
+	// still holding its fd, its worker and its slot of Throttle.MaxMapped,
+	// which bounds the abandoned scans by Concurrency. 0 means no timeout.
+	PerFileTimeout time.Duration
+
+	// Logger gets the files skipped, the per-file errors and the retries on
+	// EINTR of the batch, and of the walk of ScanDir, nil means no logging.
+	Logger Logger
+}
+
+func (o BatchOptions) logger() Logger {
+	if o.Logger == nil {
+		return nopLogger{}
+	}
+	return o.Logger
+}
+
+// Throttle paces the files of GetPcStatusBatch, it's shared by all the
+// workers, the zero value means no throttling.
+type Throttle struct {
+	// FilesPerSecond bounds the rate of files started by all the workers.
+	FilesPerSecond float64
+
+	// Delay is the sleep of every worker after a file.
+	Delay time.Duration
+
+	// MaxMapped caps the number of files mapped at the same time, when it's
+	// less than Concurrency. a file is only mapped while it's scanned.
+	MaxMapped int
+}
+
+func (o BatchOptions) hasPercentFilter() bool {
+	return o.MinPercent > 0 || o.MaxPercent > 0
+}
+
+func (o BatchOptions) matchPercent(pcs PcStatus) bool {
+	if !o.hasPercentFilter() {
+		return true
+	}
+	if pcs.Pages == 0 {
+		return false
+	}
+	if pcs.Percent < o.MinPercent {
+		return false
+	}
+	if o.MaxPercent > 0 && pcs.Percent > o.MaxPercent {
+		return false
+	}
+	return true
+}
+
+// GetPcStatusBatch gets the page cache status of the files concurrently.
+// the results are in the same order as fnames whatever order the workers
+// finish in, or sorted by name with SortByName, so the output of the same
+// files is deterministic. errs[i] is the error of stats[i] or nil, its
+// message is also in stats[i].Error so a JSON of the stats carries the
+// failed files, an error of one file doesn't abort the batch. the files
+// dropped by the percent filter are removed from both slices. it returns
+// without waiting for the scans abandoned by PerFileTimeout.
+func GetPcStatusBatch(fnames []string, opts BatchOptions) ([]PcStatus, []error) {
+	s := NewScanner(opts)
+	defer s.detach()
+	return s.Scan(fnames)
+}
+
+// GetPcStatusBatchStats is GetPcStatusBatch which also returns the
+// ScanStats of the batch, the cost of the scan itself.
+func GetPcStatusBatchStats(fnames []string, opts BatchOptions) ([]PcStatus, []error, ScanStats) {
+	s := NewScanner(opts)
+	defer s.detach()
+	return s.ScanWithStats(fnames)
+}
+
+// GetPcStatusMap is GetPcStatusBatch keyed by the file name, the duplicate
+// names of fnames are scanned once. errs only has the files which failed,
+// their statuses are still in stats with the Error. the files dropped by the
+// percent filter are in neither.
+func GetPcStatusMap(fnames []string, opts BatchOptions) (map[string]PcStatus, map[string]error) {
+	seen := make(map[string]bool, len(fnames))
+	unique := make([]string, 0, len(fnames))
+	for _, fname := range fnames {
+		if !seen[fname] {
+			seen[fname] = true
+			unique = append(unique, fname)
+		}
+	}
+
+	stats, errs := GetPcStatusBatch(unique, opts)
+	statMap := make(map[string]PcStatus, len(stats))
+	errMap := make(map[string]error)
+	for idx, pcs := range stats {
+		statMap[pcs.Name] = pcs
+		if errs[idx] != nil {
+			errMap[pcs.Name] = errs[idx]
+		}
+	}
+	return statMap, errMap
+}
+
+// SkipCounts counts the skipped statuses by their SkipReason, such as for the
+// summary `312 files skipped: permission denied`.
+func SkipCounts(stats []PcStatus) map[string]int {
+	counts := make(map[string]int)
+	for _, pcs := range stats {
+		if pcs.Skipped {
+			counts[pcs.SkipReason]++
+		}
+	}
+	return counts
+}
+
+// sortByName sorts the statuses by Name and keeps errs[i] with stats[i], the
+// equal names keep their order.
+func sortByName(stats []PcStatus, errs []error) {
+	sort.Stable(byName{stats, errs})
+}
+
+type byName struct {
+	stats []PcStatus
+	errs  []error
+}
+
+func (b byName) Len() int           { return len(b.stats) }
+func (b byName) Less(i, j int) bool { return b.stats[i].Name < b.stats[j].Name }
+
+func (b byName) Swap(i, j int) {
+	b.stats[i], b.stats[j] = b.stats[j], b.stats[i]
+	b.errs[i], b.errs[j] = b.errs[j], b.errs[i]
+}
+
+// getPrestatStatus is GetPcStatus of the file whose mode is from
+// prestatFiles, which saves the stat before the open.
+func getPrestatStatus(ctx context.Context, fname string, mode uint32, opts BatchOptions) (PcStatus, error) {
+	if err := checkStatxMode(mode); err != nil {
+		return PcStatus{Name: fname, Fork: RelationFork(fname)}, err
+	}
+	pcs, _, err := openFileStatus(ctx, fname, opts.Filter, false, opts.Options)
+	return pcs, err
+}
+
+func filterPercent(stats []PcStatus, errs []error, opts BatchOptions) ([]PcStatus, []error) {
+	var (
+		outStats = make([]PcStatus, 0, len(stats))
+		outErrs  = make([]error, 0, len(errs))
+	)
+
+	for idx, pcs := range stats {
+		if errs[idx] == nil && !opts.matchPercent(pcs) {
+			opts.logger().Debug("dropped %q by the percent filter, percent: %.2f", pcs.Name, pcs.Percent)
+			continue
+		}
+		outStats = append(outStats, pcs)
+		outErrs = append(outErrs, errs[idx])
+	}
+
+	return outStats, outErrs
+}
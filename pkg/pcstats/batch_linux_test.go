@@ -0,0 +1,44 @@
+package pcstats
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchIOUringPrestat(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pgcacher")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	fnames := []string{dir, filepath.Join(dir, "nonexistent"), filepath.Join(dir, "fifo")}
+	assert.Nil(t, syscall.Mkfifo(fnames[2], 0644))
+	for _, name := range []string{"16384", "16384.1", "16384_fsm"} {
+		fname := filepath.Join(dir, name)
+		assert.Nil(t, ioutil.WriteFile(fname, make([]byte, 3*8192), 0644))
+		fnames = append(fnames, fname)
+	}
+
+	modes := prestatFiles(fnames)
+	if modes == nil {
+		t.Skip("io_uring is not available")
+	}
+	assert.Equal(t, uint32(0), modes[1])
+	assert.Equal(t, ErrIsDirectory, checkStatxMode(modes[0]))
+	assert.Equal(t, ErrNotRegular, checkStatxMode(modes[2]))
+	assert.Nil(t, checkStatxMode(modes[3]))
+
+	want, wantErrs := GetPcStatusBatch(fnames, BatchOptions{Concurrency: 2})
+	got, gotErrs := GetPcStatusBatch(fnames, BatchOptions{Concurrency: 2, IOUringPrestat: true})
+	for idx := range fnames {
+		want[idx].Timestamp, got[idx].Timestamp = time.Time{}, time.Time{}
+		want[idx].Age, got[idx].Age = 0, 0
+	}
+	assert.Equal(t, want, got)
+	assert.Equal(t, wantErrs, gotErrs)
+}
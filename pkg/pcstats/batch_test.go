@@ -0,0 +1,288 @@
+package pcstats
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilterPercent(t *testing.T) {
+	stats := []PcStatus{
+		{Name: "cold", Pages: 10, Percent: 0},
+		{Name: "warm", Pages: 10, Percent: 50},
+		{Name: "hot", Pages: 10, Percent: 100},
+		{Name: "empty"},
+		{Name: "failed"},
+	}
+	errs := []error{nil, nil, nil, nil, errors.New("failed")}
+
+	out, outErrs := filterPercent(stats, errs, BatchOptions{MaxPercent: 60})
+	assert.Equal(t, 3, len(out))
+	assert.Equal(t, "cold", out[0].Name)
+	assert.Equal(t, "warm", out[1].Name)
+	assert.Equal(t, "failed", out[2].Name)
+	assert.NotNil(t, outErrs[2])
+
+	out, _ = filterPercent(stats, errs, BatchOptions{MinPercent: 50})
+	assert.Equal(t, 3, len(out))
+	assert.Equal(t, "hot", out[1].Name)
+}
+
+func TestTopN(t *testing.T) {
+	stats := []PcStatus{
+		{Name: "b", Size: 100, Percent: 50},
+		{Name: "a", Size: 100, Percent: 50},
+		{Name: "big", Size: 1000, Percent: 10},
+		{Name: "cold", Size: 400, Percent: 0},
+	}
+
+	top := TopN(stats, 2, SortByCachedBytes)
+	assert.Equal(t, []string{"big", "a"}, []string{top[0].Name, top[1].Name})
+
+	top = TopN(stats, 3, SortByPercent)
+	assert.Equal(t, []string{"a", "b", "big"}, []string{top[0].Name, top[1].Name, top[2].Name})
+
+	top = TopN(stats, 10, SortByUncachedBytes)
+	assert.Equal(t, 4, len(top))
+	assert.Equal(t, "big", top[0].Name)
+	assert.Equal(t, "cold", top[1].Name)
+}
+
+func TestGetPcStatusFromReader(t *testing.T) {
+	input := "# files\n\n  " + os.Args[0] + "  \n/not/exist\n"
+
+	stats, errs := GetPcStatusFromReader(strings.NewReader(input), BatchOptions{Concurrency: 2})
+	assert.Equal(t, 2, len(stats))
+	assert.Equal(t, os.Args[0], stats[0].Name)
+	assert.Nil(t, errs[0])
+	assert.Contains(t, errs[1].Error(), "line 4:")
+}
+
+func TestBatchThrottle(t *testing.T) {
+	fnames := make([]string, 5)
+	for i := range fnames {
+		fnames[i] = os.Args[0]
+	}
+
+	start := time.Now()
+	_, errs := GetPcStatusBatch(fnames, BatchOptions{
+		Concurrency: 3,
+		Throttle:    Throttle{FilesPerSecond: 100, MaxMapped: 1},
+	})
+	assert.Equal(t, make([]error, 5), errs)
+
+	// the first file waits for a tick too.
+	assert.True(t, time.Since(start) >= 50*time.Millisecond)
+}
+
+func TestBatchOnProgress(t *testing.T) {
+	fnames := []string{os.Args[0], "/nonexistent/16384", os.Args[0]}
+
+	var dones []int
+	GetPcStatusBatch(fnames, BatchOptions{
+		Concurrency: 2,
+		OnProgress: func(done, total int, current string) {
+			assert.Equal(t, 3, total)
+			dones = append(dones, done)
+		},
+	})
+	assert.Equal(t, []int{1, 2, 3}, dones)
+}
+
+func TestBatchOrder(t *testing.T) {
+	fnames := []string{"/not/exist/b", os.Args[0], "/not/exist/a"}
+
+	stats, errs := GetPcStatusBatch(fnames, BatchOptions{Concurrency: 3})
+	for idx, fname := range fnames {
+		assert.Equal(t, fname, stats[idx].Name)
+	}
+	assert.Nil(t, errs[1])
+	assert.Equal(t, "", stats[1].Error)
+	assert.Equal(t, errs[0].Error(), stats[0].Error)
+
+	b, err := json.Marshal(stats[0])
+	assert.Nil(t, err)
+	assert.Contains(t, string(b), `"error":`)
+	b, err = json.Marshal(stats[1])
+	assert.Nil(t, err)
+	assert.NotContains(t, string(b), `"error":`)
+
+	stats, errs = GetPcStatusBatch(fnames, BatchOptions{Concurrency: 3, SortByName: true})
+	for idx := 1; idx < len(stats); idx++ {
+		assert.True(t, stats[idx-1].Name <= stats[idx].Name)
+	}
+	for idx, pcs := range stats {
+		assert.Equal(t, pcs.Name == os.Args[0], errs[idx] == nil)
+	}
+}
+
+func TestGetPcStatusMap(t *testing.T) {
+	fnames := []string{os.Args[0], "/not/exist", os.Args[0]}
+
+	stats, errs := GetPcStatusMap(fnames, BatchOptions{Concurrency: 2})
+	assert.Equal(t, 2, len(stats))
+	assert.Equal(t, os.Args[0], stats[os.Args[0]].Name)
+	assert.Equal(t, 1, len(errs))
+	assert.NotNil(t, errs["/not/exist"])
+	assert.Equal(t, errs["/not/exist"].Error(), stats["/not/exist"].Error)
+}
+
+type recordLogger struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (l *recordLogger) log(level, format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lines = append(l.lines, level+" "+fmt.Sprintf(format, args...))
+}
+
+func (l *recordLogger) Debug(format string, args ...interface{}) { l.log("debug", format, args...) }
+func (l *recordLogger) Info(format string, args ...interface{})  { l.log("info", format, args...) }
+func (l *recordLogger) Warn(format string, args ...interface{})  { l.log("warn", format, args...) }
+
+func TestBatchLogger(t *testing.T) {
+	logger := new(recordLogger)
+	opts := BatchOptions{Concurrency: 2, Logger: logger, Options: Options{MaxFileSize: 1}}
+	GetPcStatusBatch([]string{"/not/exist", os.Args[0]}, opts)
+
+	sort.Strings(logger.lines)
+	assert.Equal(t, 3, len(logger.lines))
+	assert.True(t, strings.HasPrefix(logger.lines[0], "debug skipped \""+os.Args[0]+"\""))
+	assert.True(t, strings.HasPrefix(logger.lines[1], "info scanned 2 files"))
+	assert.True(t, strings.HasPrefix(logger.lines[2], "warn could not scan \"/not/exist\""))
+}
+
+func TestBatchSkipPermissionDenied(t *testing.T) {
+	fnames := []string{os.Args[0], "/not/exist"}
+	// fake the permission, the tests may run as root.
+	denied := func(f *os.File) error {
+		return fmt.Errorf("could not read %q: %w", f.Name(), os.ErrPermission)
+	}
+
+	stats, errs := GetPcStatusBatch(fnames, BatchOptions{Filter: denied})
+	assert.True(t, errors.Is(errs[0], ErrPermission))
+
+	stats, errs = GetPcStatusBatch(fnames, BatchOptions{Filter: denied, SkipPermissionDenied: true})
+	assert.Nil(t, errs[0])
+	assert.True(t, stats[0].Skipped)
+	assert.Equal(t, SkipPermission, stats[0].SkipReason)
+	assert.NotNil(t, errs[1])
+	assert.Equal(t, map[string]int{SkipPermission: 1}, SkipCounts(stats))
+}
+
+func TestScanner(t *testing.T) {
+	fnames := []string{os.Args[0], "/not/exist"}
+
+	s := NewScanner(BatchOptions{Concurrency: 2})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				stats, errs := s.Scan(fnames)
+				assert.Equal(t, os.Args[0], stats[0].Name)
+				assert.Nil(t, errs[0])
+				assert.NotNil(t, errs[1])
+			}
+		}()
+	}
+	wg.Wait()
+
+	s.Close()
+	s.Close()
+	_, errs := s.Scan(fnames)
+	assert.Equal(t, ErrScannerClosed, errs[0])
+}
+
+func TestBatchPerFileTimeout(t *testing.T) {
+	slow, err := ioutil.TempFile("", "pgcacher-slow")
+	assert.Nil(t, err)
+	defer os.Remove(slow.Name())
+	slow.Close()
+
+	fnames := []string{slow.Name(), os.Args[0]}
+	// hang the scan of the slow file, as a stalled nfs read would, until
+	// the test releases it.
+	release := make(chan struct{})
+	stall := func(f *os.File) error {
+		if f.Name() == slow.Name() {
+			<-release
+		}
+		return nil
+	}
+
+	s := NewScanner(BatchOptions{Concurrency: 2, Filter: stall, PerFileTimeout: 50 * time.Millisecond})
+	stats, errs := s.Scan(fnames)
+	assert.True(t, errors.Is(errs[0], ErrTimeout))
+	assert.Equal(t, slow.Name(), stats[0].Name)
+	assert.Nil(t, errs[1])
+	assert.Equal(t, os.Args[0], stats[1].Name)
+
+	// the abandoned scan holds its worker until it returns, Close waits for
+	// it, so nothing is left running.
+	closed := make(chan struct{})
+	go func() {
+		s.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+		t.Fatal("Close returned before the abandoned scan")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	<-closed
+}
+
+func TestGetPcStatusBatchStats(t *testing.T) {
+	f, err := ioutil.TempFile("", "pgcacher-stats")
+	assert.Nil(t, err)
+	defer os.Remove(f.Name())
+	_, err = f.Write(make([]byte, 3*4096))
+	assert.Nil(t, err)
+	f.Close()
+
+	fnames := []string{f.Name(), "/not/exist", os.Args[0]}
+	opts := BatchOptions{Concurrency: 2, Options: Options{MaxFileSize: 4096}}
+	stats, errs, ss := GetPcStatusBatchStats(fnames, opts)
+	assert.Len(t, stats, 3)
+	assert.Nil(t, errs[0])
+	assert.NotNil(t, errs[1])
+
+	assert.Equal(t, 3, ss.Files)
+	assert.Equal(t, 1, ss.Failed)
+	// both the temp file and the test binary are over MaxFileSize.
+	assert.Equal(t, 2, ss.Skipped)
+	assert.Equal(t, int64(0), ss.BytesScanned)
+
+	_, errs, ss = GetPcStatusBatchStats(fnames[:1], BatchOptions{})
+	assert.Nil(t, errs[0])
+	assert.Equal(t, 0, ss.Skipped)
+	assert.Equal(t, int64(3*4096), ss.BytesScanned)
+	assert.True(t, ss.MinFileDuration <= ss.AvgFileDuration)
+	assert.True(t, ss.AvgFileDuration <= ss.MaxFileDuration)
+	assert.True(t, ss.MaxFileDuration <= ss.Duration)
+	assert.True(t, ss.FilesPerSecond() > 0)
+}
+
+func TestBatchRejectsBitmap(t *testing.T) {
+	opts := BatchOptions{Options: Options{Bitmap: new(Bitmap)}}
+	stats, errs := GetPcStatusBatch([]string{os.Args[0], os.Args[0]}, opts)
+	for idx := range errs {
+		assert.Equal(t, ErrBatchBitmap, errs[idx])
+		assert.Equal(t, ErrBatchBitmap.Error(), stats[idx].Error)
+	}
+	assert.Equal(t, 0, opts.Options.Bitmap.Len())
+}
@@ -0,0 +1,37 @@
+package pcstats
+
+import "fmt"
+
+// BenchmarkCache measures the page cache of the files around run, such as
+// the cold run of a query: the files are evicted by EvictFile, scanned into
+// before, run is called, then they are scanned again into after, Diff of the
+// two is the pages loaded by run. an error of the eviction, of run or of the
+// scan of a file fails the whole benchmark.
+func BenchmarkCache(fnames []string, run func() error, opts ...Options) (before, after []PcStatus, err error) {
+	for _, fname := range fnames {
+		if err := EvictFile(fname); err != nil {
+			return nil, nil, fmt.Errorf("could not evict %q: %w", fname, err)
+		}
+	}
+
+	if before, err = benchmarkScan(fnames, getOptions(opts)); err != nil {
+		return nil, nil, err
+	}
+	if err := run(); err != nil {
+		return before, nil, fmt.Errorf("could not run the benchmark: %w", err)
+	}
+	if after, err = benchmarkScan(fnames, getOptions(opts)); err != nil {
+		return before, nil, err
+	}
+	return before, after, nil
+}
+
+func benchmarkScan(fnames []string, opt Options) ([]PcStatus, error) {
+	stats, errs := GetPcStatusBatch(fnames, BatchOptions{Options: opt})
+	for idx, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("could not scan %q: %w", fnames[idx], err)
+		}
+	}
+	return stats, nil
+}
@@ -0,0 +1,112 @@
+package pcstats
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"math/bits"
+)
+
+// Bitmap is the per-page residency packed into bits, page i is bit i%8 of
+// byte i/8, so the cache map of a 1GB relation takes 32KB with 4KB pages.
+type Bitmap struct {
+	n    int
+	bits []byte
+}
+
+// NewBitmap returns a Bitmap of n pages, all uncached.
+func NewBitmap(n int) *Bitmap {
+	b := new(Bitmap)
+	b.reset(n)
+	return b
+}
+
+// Len returns the number of pages.
+func (b *Bitmap) Len() int {
+	return b.n
+}
+
+// Set marks the page i as cached or not, it panics if i is out of range.
+func (b *Bitmap) Set(i int, cached bool) {
+	b.check(i)
+	if cached {
+		b.bits[i/8] |= 1 << uint(i%8)
+	} else {
+		b.bits[i/8] &^= 1 << uint(i%8)
+	}
+}
+
+// Get returns whether the page i is cached, it panics if i is out of range.
+func (b *Bitmap) Get(i int) bool {
+	b.check(i)
+	return b.bits[i/8]&(1<<uint(i%8)) != 0
+}
+
+// PopCount returns the number of cached pages.
+func (b *Bitmap) PopCount() int {
+	var count int
+	for _, v := range b.bits {
+		count += bits.OnesCount8(v)
+	}
+	return count
+}
+
+// MarshalBinary encodes the bitmap as the number of pages in 8 bytes of
+// little endian, followed by the packed bits.
+func (b *Bitmap) MarshalBinary() ([]byte, error) {
+	data := make([]byte, 8+len(b.bits))
+	binary.LittleEndian.PutUint64(data, uint64(b.n))
+	copy(data[8:], b.bits)
+	return data, nil
+}
+
+// UnmarshalBinary decodes the bitmap encoded by MarshalBinary.
+func (b *Bitmap) UnmarshalBinary(data []byte) error {
+	if len(data) < 8 {
+		return errors.New("bitmap too short")
+	}
+
+	n := binary.LittleEndian.Uint64(data)
+	if (n+7)/8 != uint64(len(data)-8) {
+		return errors.New("bitmap length mismatch")
+	}
+
+	b.n = int(n)
+	b.bits = append([]byte(nil), data[8:]...)
+	return nil
+}
+
+// Hash returns the hex sha-256 of MarshalBinary, so bitmaps of different
+// lengths never have the same hash.
+func (b *Bitmap) Hash() string {
+	data, _ := b.MarshalBinary()
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// reset resizes the bitmap to n pages, all uncached.
+func (b *Bitmap) reset(n int) {
+	b.n = n
+	b.bits = make([]byte, (n+7)/8)
+}
+
+// truncate drops the pages from n on, the spare bits of the last byte are
+// cleared so PopCount stays right.
+func (b *Bitmap) truncate(n int) {
+	if n >= b.n {
+		return
+	}
+
+	b.n = n
+	b.bits = b.bits[:(n+7)/8]
+	if n%8 != 0 {
+		b.bits[len(b.bits)-1] &= 1<<uint(n%8) - 1
+	}
+}
+
+func (b *Bitmap) check(i int) {
+	if i < 0 || i >= b.n {
+		panic("pcstats: bitmap index out of range")
+	}
+}
@@ -0,0 +1,65 @@
+//go:build linux && !mips && !mipsle && !mips64 && !mips64le
+// +build linux,!mips,!mipsle,!mips64,!mips64le
+
+package pcstats
+
+import (
+	"os"
+	"sync/atomic"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// the number of cachestat(2) since linux 6.5, the same on all the
+// architectures except mips, which uses the stub.
+const sysCachestat = 451
+
+// struct cachestat_range and struct cachestat of <linux/mman.h>.
+type cachestatRange struct {
+	off uint64
+	len uint64
+}
+
+type cachestat struct {
+	cache           uint64
+	dirty           uint64
+	writeback       uint64
+	evicted         uint64
+	recentlyEvicted uint64
+}
+
+// cachestatUnsupported is set once the kernel returns ENOSYS, so the later
+// files go to mincore right away.
+var cachestatUnsupported int32
+
+// getCachestat counts the cached and dirty kernel pages of the length bytes
+// of the file from off by cachestat(2), without mapping it. it returns false
+// when the kernel or the filesystem doesn't support it, then mincore is the
+// fallback.
+func getCachestat(f *os.File, off, length int64) (*Mincore, bool) {
+	if atomic.LoadInt32(&cachestatUnsupported) != 0 {
+		return nil, false
+	}
+
+	var (
+		crange = cachestatRange{off: uint64(off), len: uint64(length)}
+		cstat  cachestat
+	)
+	_, errno := syscallRetry(sysCachestat, f.Fd(), uintptr(unsafe.Pointer(&crange)), uintptr(unsafe.Pointer(&cstat)))
+	if errno == unix.ENOSYS {
+		atomic.StoreInt32(&cachestatUnsupported, 1)
+	}
+	if errno != 0 {
+		return nil, false
+	}
+
+	kpsz := int64(os.Getpagesize())
+	pages := (length + kpsz - 1) / kpsz
+	cached := int64(cstat.cache)
+	if cached > pages {
+		cached = pages
+	}
+
+	return &Mincore{Cached: cached, Miss: pages - cached, Dirty: int64(cstat.dirty), hasDirty: true}, true
+}
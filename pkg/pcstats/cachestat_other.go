@@ -0,0 +1,11 @@
+//go:build !linux || mips || mipsle || mips64 || mips64le
+// +build !linux mips mipsle mips64 mips64le
+
+package pcstats
+
+import "os"
+
+// getCachestat always falls back to mincore without cachestat(2).
+func getCachestat(f *os.File, off, length int64) (*Mincore, bool) {
+	return nil, false
+}
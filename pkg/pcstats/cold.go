@@ -0,0 +1,43 @@
+package pcstats
+
+import (
+	"context"
+	"os"
+)
+
+// getColdMincore counts the pages of pageSize as getFileMincore, but stops
+// once the first `windows` windows of 1MB have no cached page, and counts
+// the rest uncached too. it returns whether the rest was estimated. a cold
+// head says little of the tail in general, such as the hot tail of a table
+// being appended to, but a mostly cold archive is quickly skipped. the exact
+// cachestat(2) is used when it's available, it doesn't map the file anyway.
+func getColdMincore(ctx context.Context, f *os.File, size int64, pageSize int, windows int) (*Mincore, bool, error) {
+	head := int64(windows) * sampleWindow
+	if align := int64(pageSize); head%align != 0 {
+		head = (head/align + 1) * align
+	}
+	if windows < 1 || size <= head {
+		mincore, err := getFileMincore(ctx, f, size, pageSize, nil)
+		return mincore, false, err
+	}
+	if pageSize == os.Getpagesize() {
+		if value, ok := getCachestat(f, 0, size); ok {
+			return value, false, nil
+		}
+	}
+
+	value, err := getRangeMincore(ctx, f, 0, head, pageSize)
+	if err != nil {
+		return nil, false, err
+	}
+	pages := (size + int64(pageSize) - 1) / int64(pageSize)
+	if value.Cached == 0 {
+		return &Mincore{Miss: pages}, true, nil
+	}
+
+	rest, err := getRangeMincore(ctx, f, head, size, pageSize)
+	if err != nil {
+		return nil, false, err
+	}
+	return &Mincore{Cached: value.Cached + rest.Cached, Miss: value.Miss + rest.Miss}, false, nil
+}
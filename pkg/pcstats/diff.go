@@ -0,0 +1,56 @@
+package pcstats
+
+// PcStatusDiff is the change of the page cache status of a file between two
+// scans, see Diff.
+type PcStatusDiff struct {
+	Name         string  `json:"filename"`
+	Before       int     `json:"before"`        // cached pages of the first scan
+	After        int     `json:"after"`         // cached pages of the second scan
+	CachedDelta  int     `json:"cached_delta"`  // After - Before
+	PercentDelta float64 `json:"percent_delta"` // change of the percentage of pages cached
+	Appeared     bool    `json:"appeared"`      // the file is only in the second scan
+	Disappeared  bool    `json:"disappeared"`   // the file is only in the first scan
+}
+
+// Diff matches the statuses of two scans by Name, and returns the change of
+// every file. the files in after come first in their order, followed by the
+// disappeared files in the order of before. a missing side counts as 0
+// cached pages and 0 percent.
+func Diff(before, after []PcStatus) []PcStatusDiff {
+	prev := make(map[string]PcStatus, len(before))
+	for _, pcs := range before {
+		prev[pcs.Name] = pcs
+	}
+
+	diffs := make([]PcStatusDiff, 0, len(after))
+	seen := make(map[string]bool, len(after))
+	for _, pcs := range after {
+		seen[pcs.Name] = true
+
+		old, ok := prev[pcs.Name]
+		diffs = append(diffs, PcStatusDiff{
+			Name:         pcs.Name,
+			Before:       old.Cached,
+			After:        pcs.Cached,
+			CachedDelta:  pcs.Cached - old.Cached,
+			PercentDelta: pcs.Percent - old.Percent,
+			Appeared:     !ok,
+		})
+	}
+
+	for _, pcs := range before {
+		if seen[pcs.Name] {
+			continue
+		}
+		seen[pcs.Name] = true
+
+		diffs = append(diffs, PcStatusDiff{
+			Name:         pcs.Name,
+			Before:       pcs.Cached,
+			CachedDelta:  -pcs.Cached,
+			PercentDelta: -pcs.Percent,
+			Disappeared:  true,
+		})
+	}
+	return diffs
+}
@@ -0,0 +1,57 @@
+package pcstats
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiff(t *testing.T) {
+	before := []PcStatus{
+		{Name: "16384", Cached: 2, Percent: 50},
+		{Name: "16385", Cached: 4, Percent: 100},
+	}
+	after := []PcStatus{
+		{Name: "16386", Cached: 1, Percent: 25},
+		{Name: "16384", Cached: 3, Percent: 75},
+	}
+
+	assert.Equal(t, []PcStatusDiff{
+		{Name: "16386", After: 1, CachedDelta: 1, PercentDelta: 25, Appeared: true},
+		{Name: "16384", Before: 2, After: 3, CachedDelta: 1, PercentDelta: 25},
+		{Name: "16385", Before: 4, CachedDelta: -4, PercentDelta: -100, Disappeared: true},
+	}, Diff(before, after))
+}
+
+func TestBenchmarkCache(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("eviction is linux only")
+	}
+
+	f, err := ioutil.TempFile("", "pgcacher")
+	assert.Nil(t, err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+	_, err = f.Write(make([]byte, 4*os.Getpagesize()))
+	assert.Nil(t, err)
+
+	// the callback stands in for a query reading the relation.
+	run := func() error {
+		_, err := ioutil.ReadFile(f.Name())
+		return err
+	}
+	before, after, err := BenchmarkCache([]string{f.Name()}, run)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, before[0].Cached)
+	assert.Equal(t, 4, after[0].Cached)
+	assert.Equal(t, 4, Diff(before, after)[0].CachedDelta)
+
+	_, _, err = BenchmarkCache([]string{f.Name()}, func() error { return errors.New("query failed") })
+	assert.NotNil(t, err)
+	_, _, err = BenchmarkCache([]string{"/not/exist"}, run)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,151 @@
+package pcstats
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	kpfDirty = 4  // KPF_DIRTY of /proc/kpageflags
+	kpfIdle  = 25 // KPF_IDLE of /proc/kpageflags, since linux 4.3
+
+	pagemapPresent = 1 << 63
+	pagemapPfnMask = 1<<55 - 1
+)
+
+// getDirtyPages counts the cached pages of the file which are dirty, by the
+// flags of /proc/kpageflags. it returns 0 when kpageflags or the pfn isn't
+// readable, which needs CAP_SYS_ADMIN.
+func getDirtyPages(ctx context.Context, f *os.File, size int64) int {
+	return countPageFlag(ctx, f, size, kpfDirty, nil)
+}
+
+// countPageFlag counts the cached pages of the file with the bit of
+// /proc/kpageflags set, 0 when the flags can't be read. onSet, if not nil,
+// is called with the pfn of every counted page while it's still mapped.
+func countPageFlag(ctx context.Context, f *os.File, size int64, bit uint, onSet func(pfn uint64) error) int {
+	kpageflags, err := os.Open("/proc/kpageflags")
+	if err != nil {
+		return 0
+	}
+	defer kpageflags.Close()
+
+	var (
+		count int
+		flags = make([]byte, 8)
+	)
+	err = forEachCachedPfn(ctx, f, size, func(pfn uint64) error {
+		if _, err := kpageflags.ReadAt(flags, int64(pfn)*8); err != nil {
+			return err
+		}
+		if binary.LittleEndian.Uint64(flags)&(1<<bit) == 0 {
+			return nil
+		}
+		count++
+		if onSet != nil {
+			return onSet(pfn)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0
+	}
+	return count
+}
+
+// forEachCachedPfn calls fn with the pfn of every cached page of the file,
+// by /proc/self/pagemap, window by window of forEachMincoreWindow. only the
+// pages reported cached by mincore are touched to get mapped, but touching
+// them marks them accessed on the LRU, and a page evicted since the mincore
+// is read back in. fn is called while the pages are still mapped. the pages
+// without a pfn, which is zeroed without CAP_SYS_ADMIN, are skipped.
+func forEachCachedPfn(ctx context.Context, f *os.File, size int64, fn func(pfn uint64) error) error {
+	if size == 0 {
+		return nil
+	}
+
+	pagemap, err := os.Open("/proc/self/pagemap")
+	if err != nil {
+		return err
+	}
+	defer pagemap.Close()
+
+	return forEachMincoreWindow(ctx, f, size, mincoreWindow, func(off, length int64, vec []byte) error {
+		return forEachWindowPfn(f, pagemap, off, length, vec, fn)
+	})
+}
+
+// forEachWindowPfn is forEachCachedPfn of the window of length bytes from
+// off, whose mincore vector is vec.
+func forEachWindowPfn(f *os.File, pagemap *os.File, off, length int64, vec []byte, fn func(pfn uint64) error) error {
+	mmap, err := unix.Mmap(int(f.Fd()), off, int(length), unix.PROT_READ, unix.MAP_SHARED)
+	if err != nil {
+		return err
+	}
+	defer unix.Munmap(mmap)
+
+	var (
+		psz  = os.Getpagesize()
+		sink byte
+	)
+	for i, b := range vec {
+		if !isResident(b) {
+			continue
+		}
+		v, ok := touchPage(mmap, i*psz)
+		if !ok {
+			return errTruncatedPage
+		}
+		sink += v
+	}
+	runtime.KeepAlive(sink)
+
+	// one 64 bits entry per virtual page.
+	base := uintptr(unsafe.Pointer(&mmap[0])) / uintptr(psz)
+	entries := make([]byte, len(vec)*8)
+	if _, err := pagemap.ReadAt(entries, int64(base)*8); err != nil {
+		return err
+	}
+
+	for i, b := range vec {
+		if !isResident(b) {
+			continue
+		}
+
+		entry := binary.LittleEndian.Uint64(entries[i*8:])
+		pfn := entry & pagemapPfnMask
+		if entry&pagemapPresent == 0 || pfn == 0 {
+			continue
+		}
+		if err := fn(pfn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// errTruncatedPage is returned by forEachCachedPfn when the file is
+// truncated while its pages are touched.
+var errTruncatedPage = errors.New("page truncated while mapped")
+
+// touchPage reads a byte of the page to map it, a SIGBUS of a truncated
+// file is recovered and returns false. the byte is returned so the read
+// isn't optimized out.
+func touchPage(mmap []byte, off int) (b byte, ok bool) {
+	old := debug.SetPanicOnFault(true)
+	defer debug.SetPanicOnFault(old)
+	defer func() {
+		if recover() != nil {
+			ok = false
+		}
+	}()
+
+	return mmap[off], true
+}
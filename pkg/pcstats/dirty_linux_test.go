@@ -0,0 +1,64 @@
+package pcstats
+
+import (
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// canReadPageFlags reports whether the process has CAP_SYS_ADMIN, by the
+// CapEff of /proc/self/status, and /proc/kpageflags isn't masked.
+func canReadPageFlags(t *testing.T) bool {
+	f, err := os.Open("/proc/kpageflags")
+	if err != nil {
+		return false
+	}
+	f.Close()
+
+	b, err := ioutil.ReadFile("/proc/self/status")
+	assert.Nil(t, err)
+	for _, line := range strings.Split(string(b), "\n") {
+		if !strings.HasPrefix(line, "CapEff:") {
+			continue
+		}
+		caps, err := strconv.ParseUint(strings.TrimSpace(strings.TrimPrefix(line, "CapEff:")), 16, 64)
+		assert.Nil(t, err)
+		return caps&(1<<21) != 0
+	}
+	return false
+}
+
+func TestIncludeDirty(t *testing.T) {
+	var fnames []string
+	for i := 0; i < 2; i++ {
+		f, err := ioutil.TempFile("", "pgcacher-dirty")
+		assert.Nil(t, err)
+		defer os.Remove(f.Name())
+		// not synced, so the pages stay dirty until the writeback.
+		_, err = f.Write(make([]byte, 4*os.Getpagesize()))
+		assert.Nil(t, err)
+		f.Close()
+		fnames = append(fnames, f.Name())
+	}
+
+	// the workers touch the pages concurrently, as under -race.
+	stats, errs := GetPcStatusBatch(fnames, BatchOptions{Concurrency: 2, Options: Options{IncludeDirty: true}})
+	for idx, pcs := range stats {
+		assert.Nil(t, errs[idx])
+		assert.Equal(t, 4, pcs.Cached)
+		if canReadPageFlags(t) {
+			assert.True(t, pcs.Dirty > 0)
+		} else {
+			assert.Equal(t, 0, pcs.Dirty)
+		}
+		assert.True(t, pcs.Dirty <= pcs.Cached)
+	}
+
+	pcs, err := GetPcStatus(fnames[0], nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, pcs.Dirty)
+}
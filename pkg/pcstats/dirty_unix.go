@@ -0,0 +1,14 @@
+//go:build darwin || dragonfly || freebsd || netbsd || openbsd || solaris || windows
+// +build darwin dragonfly freebsd netbsd openbsd solaris windows
+
+package pcstats
+
+import (
+	"context"
+	"os"
+)
+
+// kpageflags is only available on linux.
+func getDirtyPages(ctx context.Context, f *os.File, size int64) int {
+	return 0
+}
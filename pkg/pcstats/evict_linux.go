@@ -0,0 +1,47 @@
+package pcstats
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// EvictFile drops the pages of the whole file from the page cache.
+//
+// POSIX_FADV_DONTNEED can't drop dirty pages, so the file is fsynced before
+// the advise, otherwise recently written pages would stay in the cache.
+func EvictFile(fname string) error {
+	return EvictRange(fname, 0, 0)
+}
+
+// EvictRange drops the pages in [offset, offset+length) of the file from the
+// page cache, a length of 0 means to the end of the file.
+func EvictRange(fname string, offset, length int64) error {
+	f, err := os.Open(fname)
+	if err != nil {
+		return fmt.Errorf("could not open file for read: %w", err)
+	}
+	defer f.Close()
+
+	size, err := getFileSize(f)
+	if err != nil {
+		return err
+	}
+	if length == 0 {
+		length = size - offset
+	}
+	if offset < 0 || length < 0 {
+		return fmt.Errorf("invalid range, offset: %d, length: %d", offset, length)
+	}
+
+	// write back dirty pages first, DONTNEED only drops clean pages.
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("could not fsync file: %v", err)
+	}
+
+	if err := unix.Fadvise(int(f.Fd()), offset, length, unix.FADV_DONTNEED); err != nil {
+		return fmt.Errorf("fadvise DONTNEED failed: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+//go:build darwin || dragonfly || freebsd || netbsd || openbsd || solaris || windows
+// +build darwin dragonfly freebsd netbsd openbsd solaris windows
+
+package pcstats
+
+import "errors"
+
+var errEvictUnsupported = errors.New("posix_fadvise eviction is only supported on linux")
+
+func EvictFile(fname string) error {
+	return errEvictUnsupported
+}
+
+func EvictRange(fname string, offset, length int64) error {
+	return errEvictUnsupported
+}
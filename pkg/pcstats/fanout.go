@@ -0,0 +1,93 @@
+package pcstats
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+// HostResult is the result of FanOutScan of one host.
+type HostResult struct {
+	Host     string
+	Statuses []PcStatus
+	Err      error
+}
+
+// FanOutScan scans the same files on all the hosts at once by RemoteScan,
+// such as the primary and its replicas, dial opens the conn to the agent of
+// a host, such as CommandTransport of `ssh host pgcacher -agent`. the
+// results are keyed by the host, a host which can't be dialed or scanned
+// has its Err set rather than failing the others.
+func FanOutScan(hosts []string, dial func(host string) (io.ReadWriteCloser, error), fnames []string, opts ...Options) map[string]HostResult {
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results = make(map[string]HostResult, len(hosts))
+	)
+
+	for _, host := range hosts {
+		wg.Add(1)
+		go func(host string) {
+			defer wg.Done()
+
+			res := HostResult{Host: host}
+			conn, err := dial(host)
+			if err != nil {
+				res.Err = fmt.Errorf("could not connect to %s: %v", host, err)
+			} else if res.Statuses, err = RemoteScan(conn, fnames, opts...); err != nil {
+				res.Err = fmt.Errorf("could not scan on %s: %v", host, err)
+			}
+
+			mu.Lock()
+			results[host] = res
+			mu.Unlock()
+		}(host)
+	}
+	wg.Wait()
+	return results
+}
+
+// CacheMatrix is the percent of the files by the host, Percent[name][host],
+// as merged by MergeHostResults. a file which failed on a host has its error
+// in Errors[name][host] rather than an entry of Percent, a file missing on
+// a host has neither.
+type CacheMatrix struct {
+	Names   []string
+	Hosts   []string
+	Percent map[string]map[string]float64
+	Errors  map[string]map[string]string
+}
+
+// MergeHostResults merges the results of FanOutScan into a CacheMatrix, the
+// names and the hosts are sorted, the hosts with Err are left out.
+func MergeHostResults(results map[string]HostResult) CacheMatrix {
+	m := CacheMatrix{
+		Percent: make(map[string]map[string]float64),
+		Errors:  make(map[string]map[string]string),
+	}
+	for host, res := range results {
+		if res.Err != nil {
+			continue
+		}
+		m.Hosts = append(m.Hosts, host)
+		for _, pcs := range res.Statuses {
+			row, ok := m.Percent[pcs.Name]
+			if !ok {
+				row = make(map[string]float64)
+				m.Percent[pcs.Name] = row
+				m.Errors[pcs.Name] = make(map[string]string)
+				m.Names = append(m.Names, pcs.Name)
+			}
+			if pcs.Error != "" {
+				m.Errors[pcs.Name][host] = pcs.Error
+				continue
+			}
+			row[host] = pcs.Percent
+		}
+	}
+
+	sort.Strings(m.Names)
+	sort.Strings(m.Hosts)
+	return m
+}
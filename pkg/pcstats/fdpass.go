@@ -0,0 +1,90 @@
+//go:build !windows
+// +build !windows
+
+package pcstats
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// maxPassedName bounds the path sent along with a fd by SendFile.
+const maxPassedName = 4096
+
+// SendFile passes the fd of f and its name over the unix socket conn by
+// SCM_RIGHTS, such as from a privileged helper which opens the files of
+// PGDATA to an unprivileged scanner calling ReceiveFile or ReceivePcStatus.
+// name is only for the reports, it may be "".
+func SendFile(conn *net.UnixConn, f *os.File, name string) error {
+	if len(name) > maxPassedName {
+		return fmt.Errorf("name of %d bytes is too long to pass", len(name))
+	}
+
+	// at least a byte of data has to go along with the fd.
+	payload := append([]byte(name), 0)
+	if _, _, err := conn.WriteMsgUnix(payload, unix.UnixRights(int(f.Fd())), nil); err != nil {
+		return fmt.Errorf("could not pass the fd: %v", err)
+	}
+	return nil
+}
+
+// ReceiveFile receives a fd and its name passed by SendFile. the file has
+// no name of its own, the path of the sender may well not resolve for the
+// receiver, such as in another mount namespace, so GetPcStatusFromFile of it
+// can't tell whether the file vanished and names it by the fd. the caller
+// owns the file.
+func ReceiveFile(conn *net.UnixConn) (*os.File, string, error) {
+	var (
+		buf = make([]byte, maxPassedName+1)
+		oob = make([]byte, unix.CmsgSpace(4))
+	)
+	n, oobn, _, _, err := conn.ReadMsgUnix(buf, oob)
+	if err != nil {
+		return nil, "", fmt.Errorf("could not receive the fd: %v", err)
+	}
+
+	msgs, err := unix.ParseSocketControlMessage(oob[:oobn])
+	if err != nil {
+		return nil, "", fmt.Errorf("could not parse the control message: %v", err)
+	}
+	var fds []int
+	for _, msg := range msgs {
+		rights, err := unix.ParseUnixRights(&msg)
+		if err != nil {
+			continue
+		}
+		fds = append(fds, rights...)
+	}
+	if len(fds) == 0 {
+		return nil, "", errors.New("no fd received")
+	}
+	// only one fd is sent at a time, don't leak any other.
+	for _, fd := range fds[1:] {
+		unix.Close(fd)
+	}
+	unix.CloseOnExec(fds[0])
+
+	name := string(bytes.TrimRight(buf[:n], "\x00"))
+	return os.NewFile(uintptr(fds[0]), ""), name, nil
+}
+
+// ReceivePcStatus receives a fd by ReceiveFile and scans it, the status is
+// named by the name sent, or by the fd without one. the file is closed.
+func ReceivePcStatus(conn *net.UnixConn, filter func(f *os.File) error, opts ...Options) (PcStatus, error) {
+	f, name, err := ReceiveFile(conn)
+	if err != nil {
+		return PcStatus{}, err
+	}
+	defer f.Close()
+
+	pcs, err := GetPcStatusFromFile(f, filter, opts...)
+	if name != "" {
+		pcs.Name, pcs.Fork = name, RelationFork(name)
+	}
+	return pcs, err
+}
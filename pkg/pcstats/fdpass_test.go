@@ -0,0 +1,55 @@
+//go:build !windows
+// +build !windows
+
+package pcstats
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+)
+
+func TestReceivePcStatus(t *testing.T) {
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_DGRAM, 0)
+	assert.Nil(t, err)
+	conns := make([]*net.UnixConn, 2)
+	for idx, fd := range fds {
+		f := os.NewFile(uintptr(fd), "socketpair")
+		conn, err := net.FileConn(f)
+		assert.Nil(t, err)
+		f.Close()
+		conns[idx] = conn.(*net.UnixConn)
+		defer conn.Close()
+	}
+
+	f, err := ioutil.TempFile("", "pgcacher")
+	assert.Nil(t, err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+	_, err = f.Write(make([]byte, 2*os.Getpagesize()))
+	assert.Nil(t, err)
+
+	// the helper passes the fd, the name is only for the report.
+	assert.Nil(t, SendFile(conns[0], f, "base/5/16384"))
+	pcs, err := ReceivePcStatus(conns[1], nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "base/5/16384", pcs.Name)
+	assert.Equal(t, ForkMain, pcs.Fork)
+	assert.Equal(t, 2, pcs.Pages)
+
+	// without a name the status is named by the fd.
+	assert.Nil(t, SendFile(conns[0], f, ""))
+	received, name, err := ReceiveFile(conns[1])
+	assert.Nil(t, err)
+	defer received.Close()
+	assert.Equal(t, "", name)
+	pcs, err = GetPcStatusFromFile(received, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, fmt.Sprintf("fd:%d", received.Fd()), pcs.Name)
+	assert.Equal(t, 2, pcs.Pages)
+}
@@ -0,0 +1,72 @@
+package pcstats
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"os"
+)
+
+const pageIdleBitmap = "/sys/kernel/mm/page_idle/bitmap"
+
+// getIdlePages counts the cached pages of the file which are idle, not
+// accessed since they were marked by MarkIdle, by KPF_IDLE of
+// /proc/kpageflags. the flag is read rather than page_idle/bitmap, whose
+// read would find the pages just touched by the scan itself accessed. the
+// mapping of the scan would clear the flag once unmapped, so the idle pages
+// are marked again while still mapped, as MarkIdle does, and the next scan
+// counts them too. it returns 0 when the flags can't be read or the bitmap
+// can't be written, as getDirtyPages.
+func getIdlePages(ctx context.Context, f *os.File, size int64) int {
+	bitmap, err := os.OpenFile(pageIdleBitmap, os.O_WRONLY, 0)
+	if err != nil {
+		return 0
+	}
+	defer bitmap.Close()
+
+	word := make([]byte, 8)
+	return countPageFlag(ctx, f, size, kpfIdle, func(pfn uint64) error {
+		return markIdlePfn(bitmap, word, pfn)
+	})
+}
+
+// MarkIdle marks the cached pages of the file idle by page_idle/bitmap,
+// the start of the interval of Options.IncludeIdle. the pages accessed
+// after it, such as by the reads of postgresql, are no more counted into
+// IdleCached. it needs CONFIG_IDLE_PAGE_TRACKING and CAP_SYS_ADMIN.
+func MarkIdle(fname string) error {
+	f, err := os.Open(fname)
+	if err != nil {
+		return fmt.Errorf("could not open file for read: %w", err)
+	}
+	defer f.Close()
+
+	size, err := getFileSize(f)
+	if err != nil {
+		return err
+	}
+
+	bitmap, err := os.OpenFile(pageIdleBitmap, os.O_WRONLY, 0)
+	if err != nil {
+		return fmt.Errorf("could not open %s: %w", pageIdleBitmap, err)
+	}
+	defer bitmap.Close()
+
+	word := make([]byte, 8)
+	err = forEachCachedPfn(context.Background(), f, size, func(pfn uint64) error {
+		return markIdlePfn(bitmap, word, pfn)
+	})
+	if err != nil {
+		return fmt.Errorf("could not mark the pages idle: %v", err)
+	}
+	return nil
+}
+
+// markIdlePfn marks the page of pfn idle by the page_idle/bitmap, which is
+// written in the aligned words of 64 pfns, the pfns of the zero bits are
+// left as is. word is the buffer of the write.
+func markIdlePfn(bitmap *os.File, word []byte, pfn uint64) error {
+	binary.LittleEndian.PutUint64(word, 1<<(pfn%64))
+	_, err := bitmap.WriteAt(word, int64(pfn/64*8))
+	return err
+}
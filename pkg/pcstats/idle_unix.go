@@ -0,0 +1,21 @@
+//go:build darwin || dragonfly || freebsd || netbsd || openbsd || solaris || windows
+// +build darwin dragonfly freebsd netbsd openbsd solaris windows
+
+package pcstats
+
+import (
+	"context"
+	"errors"
+	"os"
+)
+
+var errIdleUnsupported = errors.New("idle page tracking is only supported on linux")
+
+// kpageflags is only available on linux.
+func getIdlePages(ctx context.Context, f *os.File, size int64) int {
+	return 0
+}
+
+func MarkIdle(fname string) error {
+	return errIdleUnsupported
+}
@@ -0,0 +1,38 @@
+package pcstats
+
+import "context"
+
+// Logger receives what the scans would otherwise do silently, such as the
+// files skipped, the syscalls retried on EINTR and the per-file errors, the
+// args are formatted as fmt.Sprintf. it's called from the workers of a
+// batch concurrently, so it must be safe for concurrent use.
+type Logger interface {
+	Debug(format string, args ...interface{})
+	Info(format string, args ...interface{})
+	Warn(format string, args ...interface{})
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Debug(format string, args ...interface{}) {}
+func (nopLogger) Info(format string, args ...interface{})  {}
+func (nopLogger) Warn(format string, args ...interface{})  {}
+
+type loggerKey struct{}
+
+// withLogger passes the logger down to the syscalls, which only get the ctx
+// rather than the options.
+func withLogger(ctx context.Context, logger Logger) context.Context {
+	if logger == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// loggerFrom returns the logger of withLogger, or the no-op logger.
+func loggerFrom(ctx context.Context) Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(Logger); ok {
+		return logger
+	}
+	return nopLogger{}
+}
@@ -17,63 +17,244 @@ package pcstats
  */
 
 import (
-	"fmt"
+	"context"
 	"os"
-	"unsafe"
-
-	"golang.org/x/sys/unix"
 )
 
 type Mincore struct {
 	Cached int64
 	Miss   int64
+
+	// Dirty is the count of dirty pages, only known when the pages are
+	// counted by cachestat(2).
+	Dirty    int64
+	hasDirty bool
 }
 
 // mmap the given file, get the mincore vector, then
-// return it as an []bool
+// return the counts of cached and missing pages. an empty file, such as a
+// truncated visibility map, has zero counts, mmap of length 0 is EINVAL so
+// it's never mapped.
 func GetFileMincore(f *os.File, size int64) (*Mincore, error) {
+	return getFileMincore(context.Background(), f, size, os.Getpagesize(), nil)
+}
+
+// getFileMincore also fills bm if it isn't nil. it takes the fast path of
+// cachestat(2) on linux 6.5+ when no per-page info is needed, which counts
+// the pages without mapping the file.
+func getFileMincore(ctx context.Context, f *os.File, size int64, pageSize int, bm *Bitmap) (*Mincore, error) {
+	if size != 0 && bm == nil && pageSize == os.Getpagesize() {
+		if value, ok := getCachestat(f, 0, size); ok {
+			return value, nil
+		}
+	}
+	return getFileMincoreWindow(ctx, f, size, pageSize, mincoreWindow, bm)
+}
+
+// getFileMincoreWindow counts the pages window by window, so neither the
+// mapping nor the vector exceeds the window, a window <= 0 maps the whole
+// file at once.
+func getFileMincoreWindow(ctx context.Context, f *os.File, size int64, pageSize int, window int64, bm *Bitmap) (*Mincore, error) {
+	if bm != nil {
+		bm.reset(int((size + int64(pageSize) - 1) / int64(pageSize)))
+	}
+	if size == 0 {
+		return new(Mincore), nil
+	}
+
+	// the pages of pageSize can't span two windows.
+	if window > 0 && window%int64(pageSize) != 0 {
+		window = 0
+	}
+
+	value := new(Mincore)
+	err := forEachMincoreWindow(ctx, f, size, window, func(off, length int64, vec []byte) error {
+		if pageSize != os.Getpagesize() {
+			vec = regroupMincoreVec(vec, length, pageSize)
+		}
+
+		start := int(off / int64(pageSize))
+		for i, b := range vec {
+			if isResident(b) {
+				value.Cached++
+				if bm != nil {
+					bm.Set(start+i, true)
+				}
+			} else {
+				value.Miss++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return value, nil
+}
+
+// GetFileMincoreBitmap returns the mincore vector as an []bool, the index
+// is the page index, page i holds the bytes [i*os.Getpagesize(),
+// (i+1)*os.Getpagesize()) of the file, or [i*PageSize, (i+1)*PageSize)
+// when Options.PageSize is set.
+func GetFileMincoreBitmap(f *os.File, size int64) ([]bool, error) {
+	return getFileMincoreBitmap(context.Background(), f, size, os.Getpagesize())
+}
+
+// ForEachPage calls fn with the index and the residency of every kernel page
+// of the file in order, the mincore vector is got window by window, so at
+// most one window of it is in memory however large the file is. an error
+// of fn stops the iteration and is returned.
+func ForEachPage(f *os.File, size int64, fn func(pageIndex int, cached bool) error) error {
+	kpsz := int64(os.Getpagesize())
+	return forEachMincoreWindow(context.Background(), f, size, mincoreWindow, func(off, length int64, vec []byte) error {
+		base := int(off / kpsz)
+		for i, b := range vec {
+			if err := fn(base+i, isResident(b)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func getFileMincoreBitmap(ctx context.Context, f *os.File, size int64, pageSize int) ([]bool, error) {
+	vec, err := getMincoreVec(ctx, f, size, pageSize)
+	if err != nil || vec == nil {
+		return nil, err
+	}
+
+	bitmap := make([]bool, len(vec))
+	for i, b := range vec {
+		bitmap[i] = isResident(b)
+	}
+
+	return bitmap, nil
+}
+
+// mmap the given file and get the mincore vector, one byte per page of
+// pageSize.
+func getMincoreVec(ctx context.Context, f *os.File, size int64, pageSize int) ([]byte, error) {
+	vec, err := getKernelMincoreVec(ctx, f, size)
+	if err != nil || vec == nil {
+		return vec, err
+	}
+	if pageSize == os.Getpagesize() {
+		return vec, nil
+	}
+
+	return regroupMincoreVec(vec, size, pageSize), nil
+}
+
+// regroupMincoreVec converts the vector of kernel pages into the vector of
+// pages of pageSize, a page is cached only if all the kernel pages it spans
+// are cached.
+func regroupMincoreVec(vec []byte, size int64, pageSize int) []byte {
+	kpsz := int64(os.Getpagesize())
+	psz := int64(pageSize)
+
+	out := make([]byte, (size+psz-1)/psz)
+	for i := range out {
+		start := int64(i) * psz / kpsz
+		end := (min64((int64(i)+1)*psz, size) + kpsz - 1) / kpsz
+
+		out[i] = 1
+		for _, b := range vec[start:end] {
+			if !isResident(b) {
+				out[i] = 0
+				break
+			}
+		}
+	}
+	return out
+}
+
+// mmap the given file and get the raw mincore vector, one byte per kernel page.
+func getKernelMincoreVec(ctx context.Context, f *os.File, size int64) ([]byte, error) {
 	//skip could not mmap error when the file size is 0
 	if int(size) == 0 {
 		return nil, nil
 	}
-	// mmap is a []byte
-	mmap, err := unix.Mmap(int(f.Fd()), 0, int(size), unix.PROT_NONE, unix.MAP_SHARED)
+
+	kpsz := int64(os.Getpagesize())
+	vec := make([]byte, (size+kpsz-1)/kpsz)
+	err := forEachMincoreWindow(ctx, f, size, mincoreWindow, func(off, length int64, wvec []byte) error {
+		copy(vec[off/kpsz:], wvec)
+		return nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("could not mmap: %v", err)
+		return nil, err
 	}
-	// TODO: check for MAP_FAILED which is ((void *) -1)
-	// but maybe unnecessary since it looks like errno is always set when MAP_FAILED
-
-	// one byte per page, only LSB is used, remainder is reserved and clear
-	vecsz := (size + int64(os.Getpagesize()) - 1) / int64(os.Getpagesize())
-	vec := make([]byte, vecsz)
 
-	// get all of the arguments to the mincore syscall converted to uintptr
-	mmap_ptr := uintptr(unsafe.Pointer(&mmap[0]))
-	size_ptr := uintptr(size)
-	vec_ptr := uintptr(unsafe.Pointer(&vec[0]))
+	return vec, nil
+}
 
-	// use Go's ASM to submit directly to the kernel, no C wrapper needed
-	// mincore(2): int mincore(void *addr, size_t length, unsigned char *vec);
-	// 0 on success, takes the pointer to the mmap, a size, which is the
-	// size that came from f.Stat(), and the vector, which is a pointer
-	// to the memory behind an []byte
-	// this writes a snapshot of the data into vec which a list of 8-bit flags
-	// with the LSB set if the page in that position is currently in VFS cache
-	ret, _, err := unix.Syscall(unix.SYS_MINCORE, mmap_ptr, size_ptr, vec_ptr)
-	if ret != 0 {
-		return nil, fmt.Errorf("syscall SYS_MINCORE failed: %v", err)
+// getRangeMincore counts the pages of pageSize in the bytes [start, end) of
+// the file, start must be a multiple of both pageSize and the kernel page
+// size.
+func getRangeMincore(ctx context.Context, f *os.File, start, end int64, pageSize int) (*Mincore, error) {
+	if pageSize == os.Getpagesize() {
+		if value, ok := getCachestat(f, start, end-start); ok {
+			return value, nil
+		}
 	}
-	defer unix.Munmap(mmap)
 
 	value := new(Mincore)
+	for off := start; off < end; off += mincoreWindow {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		length := min64(mincoreWindow, end-off)
+		vec, err := getMincoreRange(ctx, f, off, length)
+		if err != nil {
+			return nil, err
+		}
+		if pageSize != os.Getpagesize() {
+			vec = regroupMincoreVec(vec, length, pageSize)
+		}
+
+		for _, b := range vec {
+			if isResident(b) {
+				value.Cached++
+			} else {
+				value.Miss++
+			}
+		}
+	}
+	return value, nil
+}
+
+// isLastPageCached checks whether the last page of pageSize of the file is
+// cached, by the mincore of only the kernel pages it spans.
+func isLastPageCached(ctx context.Context, f *os.File, size int64, pageSize int) (bool, error) {
+	if size == 0 {
+		return false, nil
+	}
+
+	kpsz := int64(os.Getpagesize())
+	start := (size - 1) / int64(pageSize) * int64(pageSize)
+	off := start / kpsz * kpsz
+
+	vec, err := getMincoreRange(ctx, f, off, size-off)
+	if err != nil {
+		return false, err
+	}
 	for _, b := range vec {
-		if b%2 == 1 {
-			value.Cached++
-		} else {
-			value.Miss++
+		if !isResident(b) {
+			return false, nil
 		}
 	}
+	return true, nil
+}
 
-	return value, nil
+// mincoreWindow bounds the size of a mmap, mapping a multi-gigabyte file at
+// once may exhaust the address space of 32-bit or memory-constrained hosts.
+var mincoreWindow int64 = 256 * 1024 * 1024
+
+// isResident checks the MINCORE_INCORE bit of the byte of the vector, the
+// other bits are reserved on linux, but set for referenced and modified
+// pages on freebsd and darwin.
+func isResident(b byte) bool {
+	return b&mincoreIncore != 0
 }
@@ -0,0 +1,134 @@
+//go:build !windows
+// +build !windows
+
+package pcstats
+
+/*
+ * Copyright 2014-2017 A. Tobey <tobert@gmail.com> @AlTobey
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const platformSupported = true
+
+// forEachMincoreWindow maps the file window by window, and calls fn with the
+// offset, the length and the mincore vector of every window, a window <= 0
+// maps the whole file at once. the window must be a multiple of the kernel
+// page size, as the offset of mmap. it stops with ctx.Err() between the
+// windows once ctx is done.
+func forEachMincoreWindow(ctx context.Context, f *os.File, size, window int64, fn func(off, length int64, vec []byte) error) error {
+	if window <= 0 {
+		window = size
+	}
+
+	for off := int64(0); off < size; off += window {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		length := min64(window, size-off)
+
+		vec, err := getMincoreRange(ctx, f, off, length)
+		if err != nil {
+			return err
+		}
+
+		if err := fn(off, length, vec); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// getMincoreRange maps the length bytes of the file from off, which must be
+// a multiple of the kernel page size, and returns their mincore vector. the
+// mapping is private and PROT_NONE without MAP_POPULATE, it's never touched,
+// so the measure can't fault a page into the cache, mincore still reports
+// the pages of the page cache of the file.
+func getMincoreRange(ctx context.Context, f *os.File, off, length int64) ([]byte, error) {
+	// mmap is a []byte
+	mmap, err := unix.Mmap(int(f.Fd()), off, int(length), unix.PROT_NONE, unix.MAP_PRIVATE)
+	if err != nil {
+		return nil, fmt.Errorf("could not mmap: %w", err)
+	}
+	defer unix.Munmap(mmap)
+	// TODO: check for MAP_FAILED which is ((void *) -1)
+	// but maybe unnecessary since it looks like errno is always set when MAP_FAILED
+
+	return mincore(ctx, mmap, length)
+}
+
+// mincore returns the mincore vector of the mapping of size bytes, the
+// retries on EINTR are logged to the logger of ctx.
+func mincore(ctx context.Context, mmap []byte, size int64) ([]byte, error) {
+	// one byte per page, only LSB is used, remainder is reserved and clear
+	vecsz := (size + int64(os.Getpagesize()) - 1) / int64(os.Getpagesize())
+	vec := make([]byte, vecsz)
+
+	// get all of the arguments to the mincore syscall converted to uintptr
+	mmap_ptr := uintptr(unsafe.Pointer(&mmap[0]))
+	size_ptr := uintptr(size)
+	vec_ptr := uintptr(unsafe.Pointer(&vec[0]))
+
+	// use Go's ASM to submit directly to the kernel, no C wrapper needed
+	// mincore(2): int mincore(void *addr, size_t length, unsigned char *vec);
+	// 0 on success, takes the pointer to the mmap, a size, which is the
+	// size that came from f.Stat(), and the vector, which is a pointer
+	// to the memory behind an []byte
+	// this writes a snapshot of the data into vec which a list of 8-bit flags
+	// with the LSB set if the page in that position is currently in VFS cache
+	var tries int
+	ret, err := retryEINTR(func() (uintptr, unix.Errno) {
+		tries++
+		r, _, errno := unix.Syscall(unix.SYS_MINCORE, mmap_ptr, size_ptr, vec_ptr)
+		return r, errno
+	})
+	if tries > 1 {
+		loggerFrom(ctx).Debug("mincore retried %d times on EINTR", tries-1)
+	}
+	if ret != 0 {
+		return nil, fmt.Errorf("syscall SYS_MINCORE failed: %v", err)
+	}
+
+	return vec, nil
+}
+
+// maxEINTRRetries bounds the retries of syscallRetry.
+const maxEINTRRetries = 5
+
+// syscallRetry issues the syscall again when it's interrupted by a signal,
+// such as a SIGCHLD in a batch scan, up to maxEINTRRetries times.
+func syscallRetry(trap, a1, a2, a3 uintptr) (uintptr, unix.Errno) {
+	return retryEINTR(func() (uintptr, unix.Errno) {
+		r, _, errno := unix.Syscall(trap, a1, a2, a3)
+		return r, errno
+	})
+}
+
+func retryEINTR(fn func() (uintptr, unix.Errno)) (uintptr, unix.Errno) {
+	for i := 0; ; i++ {
+		r, errno := fn()
+		if errno != unix.EINTR || i >= maxEINTRRetries {
+			return r, errno
+		}
+	}
+}
@@ -0,0 +1,305 @@
+package pcstats
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegroupMincoreVec(t *testing.T) {
+	kpsz := os.Getpagesize()
+
+	// four kernel pages, the last one is partial.
+	vec := []byte{1, 1, 0, 1}
+	size := int64(3*kpsz + 10)
+
+	assert.Equal(t, []byte{1, 0}, regroupMincoreVec(vec, size, 2*kpsz))
+	assert.Equal(t, []byte{0}, regroupMincoreVec(vec, size, 8*kpsz))
+	assert.Equal(t, []byte{1, 1, 1, 1, 0, 0, 1}, regroupMincoreVec(vec, size, kpsz/2))
+}
+
+func TestMincoreWindow(t *testing.T) {
+	f, err := ioutil.TempFile("", "pgcacher")
+	assert.Nil(t, err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	kpsz := os.Getpagesize()
+	size := int64(1000*kpsz + 123)
+	_, err = f.Write(make([]byte, size))
+	assert.Nil(t, err)
+
+	// drop a part of the file to get a mixed vector.
+	assert.Nil(t, f.Sync())
+	EvictRange(f.Name(), int64(100*kpsz), int64(300*kpsz))
+
+	for _, pageSize := range []int{kpsz, 2 * kpsz, 3 * kpsz} {
+		single, err := getFileMincoreWindow(context.Background(), f, size, pageSize, 0, nil)
+		assert.Nil(t, err)
+
+		chunked, err := getFileMincoreWindow(context.Background(), f, size, pageSize, int64(64*kpsz), nil)
+		assert.Nil(t, err)
+		assert.Equal(t, single, chunked)
+	}
+
+	vec, err := getKernelMincoreVec(context.Background(), f, size)
+	assert.Nil(t, err)
+	assert.Equal(t, 1001, len(vec))
+}
+
+func TestCacheRuns(t *testing.T) {
+	cached, uncached := CacheRuns([]bool{true, true, false, true, false, false, false, true})
+	assert.Equal(t, []int{0, 2, 1}, cached)
+	assert.Equal(t, []int{0, 1, 0, 1}, uncached)
+
+	cached, uncached = CacheRuns(nil)
+	assert.Nil(t, cached)
+	assert.Nil(t, uncached)
+}
+
+func TestBitmap(t *testing.T) {
+	bm := NewBitmap(11)
+	bm.Set(0, true)
+	bm.Set(9, true)
+	bm.Set(10, true)
+	bm.Set(10, false)
+	assert.True(t, bm.Get(9))
+	assert.False(t, bm.Get(10))
+	assert.Equal(t, 2, bm.PopCount())
+
+	data, err := bm.MarshalBinary()
+	assert.Nil(t, err)
+	assert.Equal(t, 8+2, len(data))
+
+	decoded := new(Bitmap)
+	assert.Nil(t, decoded.UnmarshalBinary(data))
+	assert.Equal(t, bm, decoded)
+	assert.NotNil(t, decoded.UnmarshalBinary(data[:9]))
+
+	bm.truncate(9)
+	assert.Equal(t, 1, bm.PopCount())
+}
+
+func TestOptionsBitmap(t *testing.T) {
+	f, err := ioutil.TempFile("", "pgcacher")
+	assert.Nil(t, err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	kpsz := os.Getpagesize()
+	_, err = f.Write(make([]byte, 64*kpsz))
+	assert.Nil(t, err)
+	assert.Nil(t, f.Sync())
+	EvictRange(f.Name(), int64(8*kpsz), int64(16*kpsz))
+
+	bm := new(Bitmap)
+	pcs, err := GetPcStatus(f.Name(), nil, Options{Bitmap: bm})
+	assert.Nil(t, err)
+	assert.Equal(t, pcs.Pages, bm.Len())
+	assert.Equal(t, pcs.Cached, bm.PopCount())
+
+	_, bools, err := GetPcStatusWithBitmap(f.Name(), nil)
+	assert.Nil(t, err)
+	for i, cached := range bools {
+		assert.Equal(t, cached, bm.Get(i), i)
+	}
+}
+
+func TestCachestat(t *testing.T) {
+	f, err := ioutil.TempFile("", "pgcacher")
+	assert.Nil(t, err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	kpsz := os.Getpagesize()
+	size := int64(256*kpsz + 123)
+	_, err = f.Write(make([]byte, size))
+	assert.Nil(t, err)
+	assert.Nil(t, f.Sync())
+	EvictRange(f.Name(), int64(64*kpsz), int64(64*kpsz))
+
+	fast, ok := getCachestat(f, 0, size)
+	if !ok {
+		t.Skip("cachestat isn't supported")
+	}
+
+	slow, err := getFileMincoreWindow(context.Background(), f, size, kpsz, 0, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, slow.Cached, fast.Cached)
+	assert.Equal(t, slow.Miss, fast.Miss)
+}
+
+func TestGetFileMincoreEmpty(t *testing.T) {
+	f, err := ioutil.TempFile("", "pgcacher")
+	assert.Nil(t, err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	mincore, err := GetFileMincore(f, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, &Mincore{}, mincore)
+
+	bitmap, err := GetFileMincoreBitmap(f, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(bitmap))
+}
+
+func TestForEachPage(t *testing.T) {
+	f, err := ioutil.TempFile("", "pgcacher")
+	assert.Nil(t, err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	kpsz := os.Getpagesize()
+	_, err = f.Write(make([]byte, 16*kpsz))
+	assert.Nil(t, err)
+
+	bitmap, err := GetFileMincoreBitmap(f, int64(16*kpsz))
+	assert.Nil(t, err)
+
+	var pages []bool
+	err = ForEachPage(f, int64(16*kpsz), func(pageIndex int, cached bool) error {
+		assert.Equal(t, len(pages), pageIndex)
+		pages = append(pages, cached)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, bitmap, pages)
+
+	errStop := errors.New("stop")
+	calls := 0
+	err = ForEachPage(f, int64(16*kpsz), func(pageIndex int, cached bool) error {
+		calls++
+		if pageIndex == 3 {
+			return errStop
+		}
+		return nil
+	})
+	assert.Equal(t, errStop, err)
+	assert.Equal(t, 4, calls)
+
+	assert.Nil(t, ForEachPage(f, 0, func(int, bool) error { return errStop }))
+}
+
+func TestGetFileMincoreSampled(t *testing.T) {
+	defer func(window int64) { sampleWindow = window }(sampleWindow)
+	kpsz := os.Getpagesize()
+	sampleWindow = int64(4 * kpsz)
+
+	f, err := ioutil.TempFile("", "pgcacher")
+	assert.Nil(t, err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	size := int64(64 * kpsz)
+	_, err = f.Write(make([]byte, size))
+	assert.Nil(t, err)
+	assert.Nil(t, f.Sync())
+
+	mincore, err := GetFileMincoreSampled(f, size, 4, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(64), mincore.Cached+mincore.Miss)
+	assert.Equal(t, int64(64), mincore.Cached)
+
+	assert.Nil(t, EvictRange(f.Name(), 0, size))
+	pcs, err := GetPcStatus(f.Name(), nil, Options{Sample: 4, SampleSeed: 1})
+	assert.Nil(t, err)
+	assert.True(t, pcs.Approximate)
+	assert.Equal(t, 64, pcs.Pages)
+	assert.Equal(t, 0, pcs.Cached)
+
+	// the same seed samples the same windows.
+	first, _, err := getSampledMincore(context.Background(), f, size, kpsz, 3, 42)
+	assert.Nil(t, err)
+	second, _, err := getSampledMincore(context.Background(), f, size, kpsz, 3, 42)
+	assert.Nil(t, err)
+	assert.Equal(t, first, second)
+
+	exact, err := GetPcStatus(f.Name(), nil, Options{Sample: 1})
+	assert.Nil(t, err)
+	assert.False(t, exact.Approximate)
+}
+
+func TestMincoreDoesNotPerturb(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("eviction is linux only")
+	}
+
+	f, err := ioutil.TempFile("", "pgcacher")
+	assert.Nil(t, err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+	size := int64(64 * os.Getpagesize())
+	_, err = f.Write(make([]byte, size))
+	assert.Nil(t, err)
+	assert.Nil(t, f.Sync())
+	assert.Nil(t, EvictFile(f.Name()))
+
+	// every path which maps the file, repeated, none may fault a page in.
+	for i := 0; i < 3; i++ {
+		for _, opt := range []Options{{}, {PageSize: 8192}, {Bitmap: new(Bitmap)}, {SkipHoles: true}, {Sample: 2}} {
+			pcs, err := GetPcStatus(f.Name(), nil, opt)
+			assert.Nil(t, err)
+			assert.Equal(t, 0, pcs.Cached, "%+v", opt)
+		}
+		bitmap, err := GetFileMincoreBitmap(f, size)
+		assert.Nil(t, err)
+		assert.NotContains(t, bitmap, true)
+		assert.Nil(t, ForEachPage(f, size, func(_ int, cached bool) error {
+			assert.False(t, cached)
+			return nil
+		}))
+	}
+
+	vec, err := getMincoreRange(context.Background(), f, 0, size)
+	assert.Nil(t, err)
+	for _, b := range vec {
+		assert.False(t, isResident(b))
+	}
+}
+
+func TestUncachedRanges(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("eviction is linux only")
+	}
+
+	f, err := ioutil.TempFile("", "pgcacher")
+	assert.Nil(t, err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+	size := int64(8*os.Getpagesize() + 100)
+	_, err = f.Write(make([]byte, size))
+	assert.Nil(t, err)
+	assert.Nil(t, f.Sync())
+
+	ranges, err := UncachedRanges(f, size)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(ranges))
+
+	assert.Nil(t, EvictFile(f.Name()))
+	ranges, err = UncachedRanges(f, size)
+	assert.Nil(t, err)
+	assert.Equal(t, []ByteRange{{Offset: 0, Length: size}}, ranges)
+
+	// the readahead may cache more than the page asked, so only check the
+	// ranges are coalesced and match the cached bytes.
+	_, err = WarmRange(f.Name(), int64(2*os.Getpagesize()), int64(os.Getpagesize()))
+	assert.Nil(t, err)
+	ranges, err = UncachedRanges(f, size)
+	assert.Nil(t, err)
+	var uncached int64
+	for idx, r := range ranges {
+		if idx > 0 {
+			assert.True(t, ranges[idx-1].Offset+ranges[idx-1].Length < r.Offset)
+		}
+		uncached += r.Length
+	}
+	pcs, err := GetPcStatus(f.Name(), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, size-pcs.CachedBytes, uncached)
+}
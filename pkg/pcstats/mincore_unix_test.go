@@ -0,0 +1,32 @@
+//go:build !windows
+// +build !windows
+
+package pcstats
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+)
+
+func TestRetryEINTR(t *testing.T) {
+	calls := 0
+	_, errno := retryEINTR(func() (uintptr, unix.Errno) {
+		calls++
+		if calls < 3 {
+			return 1, unix.EINTR
+		}
+		return 0, 0
+	})
+	assert.Equal(t, unix.Errno(0), errno)
+	assert.Equal(t, 3, calls)
+
+	calls = 0
+	_, errno = retryEINTR(func() (uintptr, unix.Errno) {
+		calls++
+		return 1, unix.EINTR
+	})
+	assert.Equal(t, unix.EINTR, errno)
+	assert.Equal(t, maxEINTRRetries+1, calls)
+}
@@ -17,9 +17,11 @@ package pcstats
  */
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 
@@ -70,3 +72,62 @@ func setns(fd int) error {
 
 	return nil
 }
+
+// openInRoot opens fname in the root of the mount namespace of pid, see
+// Options.MountNamespacePID. the file has no name, as its path in the
+// namespace of pgcacher, if any, is another file.
+func openInRoot(pid int, fname string, flag int) (*os.File, error) {
+	return openInRootDir(filepath.Join("/proc", strconv.Itoa(pid), "root"), fname, flag)
+}
+
+// statInRoot is os.Stat of fname in the root of the mount namespace of pid.
+func statInRoot(pid int, fname string) (os.FileInfo, error) {
+	f, err := openInRoot(pid, fname, unix.O_PATH)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return f.Stat()
+}
+
+// openInRootDir opens fname by openat2(RESOLVE_IN_ROOT) relative to root,
+// so the absolute symlinks, such as the pg_tblspc/<oid> of a container,
+// are resolved against root rather than the root of pgcacher. on the
+// kernels without openat2, before 5.6, the paths through a symlink are
+// refused rather than resolved against the wrong root.
+func openInRootDir(root, fname string, flag int) (*os.File, error) {
+	dir, err := os.Open(root)
+	if err != nil {
+		return nil, err
+	}
+	defer dir.Close()
+
+	how := unix.OpenHow{Flags: uint64(flag | unix.O_CLOEXEC), Resolve: unix.RESOLVE_IN_ROOT}
+	fd, err := unix.Openat2(int(dir.Fd()), fname, &how)
+	if errors.Is(err, unix.ENOSYS) {
+		if err := checkNoSymlinks(root, fname); err != nil {
+			return nil, err
+		}
+		return os.OpenFile(filepath.Join(root, fname), flag, 0)
+	}
+	if err != nil {
+		return nil, &os.PathError{Op: "openat2", Path: fname, Err: err}
+	}
+	return os.NewFile(uintptr(fd), ""), nil
+}
+
+// checkNoSymlinks fails if any component of fname under root is a symlink.
+func checkNoSymlinks(root, fname string) error {
+	path := root
+	for _, part := range strings.Split(filepath.Clean("/"+fname), "/")[1:] {
+		path = filepath.Join(path, part)
+		finfo, err := os.Lstat(path)
+		if err != nil {
+			return err
+		}
+		if finfo.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("could not resolve %q in %s without openat2, %s is a symlink", fname, root, path)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package pcstats
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpenInRootDir(t *testing.T) {
+	root, err := ioutil.TempDir("", "pgcacher-root")
+	assert.Nil(t, err)
+	defer os.RemoveAll(root)
+
+	// a tablespace of the container, the symlink is absolute in its root.
+	assert.Nil(t, os.MkdirAll(filepath.Join(root, "pgdata", "pg_tblspc"), 0755))
+	assert.Nil(t, os.MkdirAll(filepath.Join(root, "mnt", "ts1"), 0755))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(root, "mnt", "ts1", "16401"), make([]byte, 8192), 0644))
+	assert.Nil(t, os.Symlink("/mnt/ts1", filepath.Join(root, "pgdata", "pg_tblspc", "16400")))
+
+	fname := "/pgdata/pg_tblspc/16400/16401"
+	f, err := openInRootDir(root, fname, os.O_RDONLY)
+	if err != nil {
+		// openat2 is refused, such as by seccomp, the symlink must be too.
+		assert.NotNil(t, checkNoSymlinks(root, fname))
+		t.Skipf("openat2 isn't available: %v", err)
+	}
+	defer f.Close()
+	finfo, err := f.Stat()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(8192), finfo.Size())
+
+	// the same path joined to the root follows the symlink out of it.
+	_, err = os.Stat(filepath.Join(root, fname))
+	assert.True(t, os.IsNotExist(err))
+
+	assert.NotNil(t, checkNoSymlinks(root, fname))
+	assert.Nil(t, checkNoSymlinks(root, "/mnt/ts1/16401"))
+}
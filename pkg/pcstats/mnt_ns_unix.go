@@ -1,5 +1,5 @@
-//go:build darwin || dragonfly || freebsd || netbsd || openbsd || solaris
-// +build darwin dragonfly freebsd netbsd openbsd solaris
+//go:build darwin || dragonfly || freebsd || netbsd || openbsd || solaris || windows
+// +build darwin dragonfly freebsd netbsd openbsd solaris windows
 
 package pcstats
 
@@ -19,6 +19,20 @@ package pcstats
  * limitations under the License.
  */
 
+import (
+	"fmt"
+	"os"
+)
+
 func SwitchMountNs(pid int) {
 	return
 }
+
+// there is no /proc/<pid>/root, MountNamespacePID is linux only.
+func openInRoot(pid int, fname string, flag int) (*os.File, error) {
+	return nil, fmt.Errorf("could not open %q in the root of pid %d: %w", fname, pid, ErrUnsupportedPlatform)
+}
+
+func statInRoot(pid int, fname string) (os.FileInfo, error) {
+	return nil, fmt.Errorf("could not stat %q in the root of pid %d: %w", fname, pid, ErrUnsupportedPlatform)
+}
@@ -0,0 +1,171 @@
+package pcstats
+
+import (
+	"os"
+	"time"
+)
+
+// Options controls how the page cache status of a file is collected.
+type Options struct {
+	// PageSize is the size of a page used to count Pages and Cached, 0
+	// means the page size of the running kernel. when it differs from the
+	// kernel page size, a page is cached only if all the kernel pages it
+	// spans are cached.
+	PageSize int
+
+	// BlockSize is the size of the postgresql blocks of PcStatus.CachedBlocks,
+	// 0 means DefaultBlockSize.
+	BlockSize int
+
+	// IncludeDirty counts the dirty pages of the cached pages into
+	// PcStatus.Dirty, it's left 0 when /proc/kpageflags isn't readable or
+	// the pfns of /proc/self/pagemap are hidden, both need CAP_SYS_ADMIN.
+	// unlike the rest of the scan, it perturbs the cache: the cached pages
+	// are touched to get their pfns, which marks them accessed on the LRU,
+	// and a page evicted since the mincore is read back in. it's linux only.
+	IncludeDirty bool
+
+	// IncludeIdle counts the cached pages which are idle, not accessed since
+	// MarkIdle, into PcStatus.IdleCached, the ones likely to be reclaimed
+	// first under the memory pressure. it's left 0 without the idle page
+	// tracking or when /proc/kpageflags and page_idle/bitmap aren't
+	// accessible, which need CAP_SYS_ADMIN. the scan leaves the idle pages
+	// idle, so every scan of an interval counts them. it's linux only.
+	IncludeIdle bool
+
+	// SkipHoles excludes the uncached pages in the holes of sparse files from
+	// Pages and Uncached, and counts them into PcStatus.Sparse.
+	SkipHoles bool
+
+	// IncludeAllocated reports the allocated size of the file from
+	// st_blocks into PcStatus.Allocated, and counts the cached pages between
+	// the end of the file and the end of the allocation, such as the space
+	// preallocated by fallocate, into PcStatus.CachedBeyondEOF. it costs one
+	// more mincore of the allocated size.
+	IncludeAllocated bool
+
+	// PhysicalPercent computes PcStatus.Percent by the CachedBytes against
+	// PcStatus.Allocated, which it fills as IncludeAllocated does, instead
+	// of the pages of Size, such as for the files on zfs or btrfs with
+	// compression, whose physical size is much smaller.
+	// the page cache still holds the logical pages, so the percent is
+	// capped at 100. it's ignored without a physical size, such as for the
+	// block devices, and with a range.
+	PhysicalPercent bool
+
+	// Bitmap is reset and filled with the per-page residency when it's set,
+	// PopCount matches PcStatus.Cached, the pages of holes skipped by
+	// SkipHoles are left uncached. it's cheaper than GetPcStatusWithBitmap
+	// for huge files, one bit rather than one byte per page. it's single-file
+	// only, the workers of a batch would fill the same Bitmap concurrently,
+	// so GetPcStatusBatch, Scanner and ScanDir fail every file with
+	// ErrBatchBitmap when it's set.
+	Bitmap *Bitmap `json:"-"`
+
+	// HashResidency sets PcStatus.ResidencyHash, a fingerprint of which
+	// pages are cached, two scans have the same hash only if the same pages
+	// are cached, which is cheaper to compare than the whole bitmap.
+	HashResidency bool
+
+	// Weight is the importance of the page of the index, such as the
+	// metapage and the root of a btree, PcStatus.WeightedPercent is the
+	// percentage of the weight of the cached pages, so the structurally
+	// important pages count more than the leaves. nil means the uniform
+	// weight, WeightedPercent is the same as Percent. the pages of the
+	// holes skipped by SkipHoles count as uncached.
+	Weight func(pageIndex int) float64 `json:"-"`
+
+	// Sample mincores only 1 of every Sample windows of 1MB of the file, the
+	// window of each group is picked randomly by SampleSeed, and
+	// extrapolates Cached to the whole file with PcStatus.Approximate set.
+	// it's much faster for a rough overview of huge relations, but a sample
+	// may miss a small hot region, see GetFileMincoreSampled. 0 or 1 scans
+	// every page, so do the options needing all the pages, such as
+	// SkipHoles, Bitmap, HashResidency and Weight, and GetPcStatusWithBitmap.
+	Sample     int
+	SampleSeed int64
+
+	// StopIfCold stops the scan of a file once its first StopIfCold windows
+	// of 1MB have no cached page, the rest is counted uncached with
+	// PcStatus.Approximate set, such as for finding the hot files of a
+	// mostly cold archive. a file with a cached page in the head is scanned
+	// exactly. 0 disables it, it's ignored with Sample and by the options
+	// needing all the pages as Sample.
+	StopIfCold int
+
+	// BlockDeviceResidency also counts the cached pages of a block device,
+	// such as the raw device or the lvm volume of a tablespace, rather than
+	// only reporting its size. when the device can't be mapped, such as for
+	// the permission, only the size is reported.
+	BlockDeviceResidency bool
+
+	// Previous is the status of the file from the last scan, with
+	// TrustUnchanged, it's returned as is with Skipped set when the size and
+	// mtime of the file are unchanged, no mincore is done. it's an explicit
+	// optimization for the caller, the page cache may well change without
+	// any change of the mtime, such as reading or evicting the file.
+	Previous       *PcStatus
+	TrustUnchanged bool
+
+	// MountNamespacePID opens the files in the mount namespace of the
+	// process, such as the postgres of a container scanned by an agent on
+	// the host, the paths are resolved by openat2(RESOLVE_IN_ROOT) from its
+	// root of /proc/<pid>/root, so the absolute symlinks of pg_tblspc point
+	// into the container too, and Name is still the path given. the paths
+	// through a symlink are refused on the kernels without openat2, before
+	// 5.6, and the files aren't checked for ErrFileVanished. setns(2) isn't
+	// usable here, a mount namespace can't be entered by a multithreaded
+	// process. it's linux only, 0 means the namespace of pgcacher itself.
+	MountNamespacePID int
+
+	// MaxFileSize skips the files larger than it by the size from stat, they
+	// are returned with Skipped set and no counts rather than an error, 0
+	// means no limit.
+	MaxFileSize int64
+
+	// Offset and Length limit the scan to the bytes [Offset, Offset+Length)
+	// of the file, such as a few thousand hot blocks of a 1GB segment, only
+	// the range is mapped and counted into Pages and Cached. Length 0 means
+	// up to the end of the file. the range is widened to the pages it
+	// spans, the options needing all the pages, such as SkipHoles, Bitmap,
+	// HashResidency, Weight and IncludeAllocated, are ignored with a range,
+	// and GetPcStatusWithBitmap always scans the whole file.
+	Offset int64
+	Length int64
+
+	// NoAtime opens the files with O_NOATIME, so the scans don't update
+	// their atime. it needs the ownership of the file or CAP_FOWNER, the
+	// open falls back to the usual one on EPERM. it's linux only.
+	NoAtime bool
+}
+
+func (o Options) hasRange() bool {
+	return o.Offset > 0 || o.Length > 0
+}
+
+// unchanged returns whether the previous status can be returned as is.
+func (o Options) unchanged(size int64, mtime time.Time) bool {
+	if !o.TrustUnchanged || o.Previous == nil {
+		return false
+	}
+	return o.Previous.Size == size && o.Previous.Mtime.Equal(mtime)
+}
+
+func (o Options) tooLarge(size int64) bool {
+	return o.MaxFileSize > 0 && size > o.MaxFileSize
+}
+
+func (o Options) pageSize() int {
+	if o.PageSize > 0 {
+		return o.PageSize
+	}
+	return os.Getpagesize()
+}
+
+// getOptions returns the first options of the variadic args, or the defaults.
+func getOptions(opts []Options) Options {
+	if len(opts) == 0 {
+		return Options{}
+	}
+	return opts[0]
+}
@@ -0,0 +1,242 @@
+package pcstats
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// JSONVersion is the version of the JSON of PcStatus in JSONEnvelope, it's
+// bumped on the breaking changes of the fields, such as a rename or a
+// change of the unit, adding a field isn't breaking.
+const JSONVersion = 1
+
+// JSONEnvelope is the JSON document of WriteJSONEnvelope.
+type JSONEnvelope struct {
+	Version     int       `json:"version"`
+	GeneratedAt time.Time `json:"generated_at"`
+
+	// the host of the scan, so the page counts of a fleet of different
+	// hosts can be told apart. PageSize is the kernel page size, the ones
+	// which can't be known are empty.
+	Hostname      string `json:"hostname,omitempty"`
+	KernelRelease string `json:"kernel_release,omitempty"`
+	PageSize      int    `json:"page_size"`
+
+	Statuses []PcStatus `json:"statuses"`
+}
+
+// WriteJSONEnvelope writes the statuses in a JSONEnvelope of the current
+// JSONVersion and the host info, so the long-lived consumers can detect an
+// incompatible output, the statuses are never null.
+func WriteJSONEnvelope(w io.Writer, statuses []PcStatus) error {
+	if statuses == nil {
+		statuses = []PcStatus{}
+	}
+
+	hostname, _ := os.Hostname()
+	env := JSONEnvelope{
+		Version:       JSONVersion,
+		GeneratedAt:   time.Now(),
+		Hostname:      hostname,
+		KernelRelease: kernelRelease(),
+		PageSize:      os.Getpagesize(),
+		Statuses:      statuses,
+	}
+	if err := json.NewEncoder(w).Encode(env); err != nil {
+		return fmt.Errorf("JSON formatting failed: %v", err)
+	}
+	return nil
+}
+
+// SaveSnapshot writes the statuses of a scan as a snapshot, which is the
+// JSON of WriteJSONEnvelope, to report them again later by LoadSnapshot,
+// such as offline or for the fixtures of the tests.
+func SaveSnapshot(w io.Writer, statuses []PcStatus) error {
+	return WriteJSONEnvelope(w, statuses)
+}
+
+// LoadSnapshot reads the statuses of a snapshot of SaveSnapshot, or of
+// WriteJSONEnvelope. the snapshots of a newer JSONVersion are refused, the
+// meaning of their fields may have changed.
+func LoadSnapshot(r io.Reader) ([]PcStatus, error) {
+	var env JSONEnvelope
+	if err := json.NewDecoder(r).Decode(&env); err != nil {
+		return nil, fmt.Errorf("could not decode the snapshot: %v", err)
+	}
+	if env.Version == 0 {
+		return nil, errors.New("not a snapshot, no version")
+	}
+	if env.Version > JSONVersion {
+		return nil, fmt.Errorf("snapshot version %d is newer than %d", env.Version, JSONVersion)
+	}
+	return env.Statuses, nil
+}
+
+// WriteJSONStream writes the status received from ch as a JSON array until
+// ch is closed, entries are written as they arrive, so the whole list never
+// has to be in memory.
+func WriteJSONStream(w io.Writer, ch <-chan PcStatus) error {
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+
+	first := true
+	for pcs := range ch {
+		b, err := json.Marshal(pcs)
+		if err != nil {
+			return fmt.Errorf("JSON formatting failed: %v", err)
+		}
+
+		if !first {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+		first = false
+
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+
+	_, err := io.WriteString(w, "]\n")
+	return err
+}
+
+// WriteNDJSON writes the statuses as newline-delimited JSON, one status per
+// line without the enclosing array, for the log pipelines such as loki.
+func WriteNDJSON(w io.Writer, statuses []PcStatus) error {
+	enc := json.NewEncoder(w)
+	for _, pcs := range statuses {
+		if err := enc.Encode(pcs); err != nil {
+			return fmt.Errorf("JSON formatting failed: %v", err)
+		}
+	}
+	return nil
+}
+
+// WriteNDJSONStream is the same as WriteNDJSON, but writes the status
+// received from ch until ch is closed.
+func WriteNDJSONStream(w io.Writer, ch <-chan PcStatus) error {
+	enc := json.NewEncoder(w)
+	for pcs := range ch {
+		if err := enc.Encode(pcs); err != nil {
+			return fmt.Errorf("JSON formatting failed: %v", err)
+		}
+	}
+	return nil
+}
+
+// WriteJSONGzip writes the statuses as a gzipped JSON array, such as for
+// shipping the scans of a cluster to the object storage without a gzip
+// process. the gzip stream is closed, so w gets a complete file.
+func WriteJSONGzip(w io.Writer, statuses []PcStatus) error {
+	return writeGzip(w, func(gw io.Writer) error {
+		if statuses == nil {
+			statuses = []PcStatus{}
+		}
+		if err := json.NewEncoder(gw).Encode(statuses); err != nil {
+			return fmt.Errorf("JSON formatting failed: %v", err)
+		}
+		return nil
+	})
+}
+
+// WriteNDJSONGzip is WriteNDJSON in a gzip stream, as WriteJSONGzip.
+func WriteNDJSONGzip(w io.Writer, statuses []PcStatus) error {
+	return writeGzip(w, func(gw io.Writer) error {
+		return WriteNDJSON(gw, statuses)
+	})
+}
+
+// writeGzip runs write on a gzip.Writer of w and closes it, which flushes
+// the compressed data and writes the gzip footer.
+func writeGzip(w io.Writer, write func(io.Writer) error) error {
+	gw := gzip.NewWriter(w)
+	if err := write(gw); err != nil {
+		gw.Close()
+		return err
+	}
+	if err := gw.Close(); err != nil {
+		return fmt.Errorf("could not close the gzip stream: %v", err)
+	}
+	return nil
+}
+
+// WriteYAML writes the statuses as a YAML sequence, the keys are the same as
+// the JSON, the timestamps are in RFC 3339.
+func WriteYAML(w io.Writer, statuses []PcStatus) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if statuses == nil {
+		statuses = []PcStatus{}
+	}
+	if err := enc.Encode(statuses); err != nil {
+		return fmt.Errorf("YAML formatting failed: %v", err)
+	}
+	return enc.Close()
+}
+
+// CSVOptions controls the optional columns of WriteCSV, which come after
+// the fixed ones.
+type CSVOptions struct {
+	// RelName adds the rel_name column of PcStatus.RelName.
+	RelName bool
+
+	// DirectIO adds the direct_io column of PcStatus.DirectIO.
+	DirectIO bool
+}
+
+// WriteCSV writes the statuses as csv with a header row, the names with
+// commas or quotes are quoted as RFC 4180, mtime is in RFC 3339.
+func WriteCSV(w io.Writer, statuses []PcStatus, opts ...CSVOptions) error {
+	var opt CSVOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+
+	header := []string{"filename", "size", "pages", "cached", "uncached", "percent", "mtime"}
+	if opt.RelName {
+		header = append(header, "rel_name")
+	}
+	if opt.DirectIO {
+		header = append(header, "direct_io")
+	}
+	cw := csv.NewWriter(w)
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+
+	for _, pcs := range statuses {
+		record := []string{
+			pcs.Name,
+			strconv.FormatInt(pcs.Size, 10),
+			strconv.Itoa(pcs.Pages),
+			strconv.Itoa(pcs.Cached),
+			strconv.Itoa(pcs.Uncached),
+			strconv.FormatFloat(pcs.Percent, 'f', 3, 64),
+			pcs.Mtime.Format(time.RFC3339),
+		}
+		if opt.RelName {
+			record = append(record, pcs.RelName)
+		}
+		if opt.DirectIO {
+			record = append(record, strconv.FormatBool(pcs.DirectIO))
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
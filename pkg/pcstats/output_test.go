@@ -0,0 +1,239 @@
+package pcstats
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteJSONStream(t *testing.T) {
+	ch := make(chan PcStatus, 2)
+	ch <- PcStatus{Name: "16384", Pages: 2}
+	ch <- PcStatus{Name: "16385", Pages: 4}
+	close(ch)
+
+	buf := new(bytes.Buffer)
+	assert.Nil(t, WriteJSONStream(buf, ch))
+
+	var stats []PcStatus
+	assert.Nil(t, json.Unmarshal(buf.Bytes(), &stats))
+	assert.Equal(t, 2, len(stats))
+	assert.Equal(t, "16385", stats[1].Name)
+
+	empty := make(chan PcStatus)
+	close(empty)
+
+	buf.Reset()
+	assert.Nil(t, WriteJSONStream(buf, empty))
+	assert.Equal(t, "[]\n", buf.String())
+}
+
+func TestWriteNDJSON(t *testing.T) {
+	buf := new(bytes.Buffer)
+	assert.Nil(t, WriteNDJSON(buf, []PcStatus{{Name: "16384", Pages: 2}, {Name: "16385", Pages: 4}}))
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	assert.Equal(t, 2, len(lines))
+
+	var pcs PcStatus
+	assert.Nil(t, json.Unmarshal([]byte(lines[1]), &pcs))
+	assert.Equal(t, "16385", pcs.Name)
+	assert.Equal(t, 4, pcs.Pages)
+
+	ch := make(chan PcStatus, 1)
+	ch <- PcStatus{Name: "16384", Pages: 2}
+	close(ch)
+
+	streamed := new(bytes.Buffer)
+	assert.Nil(t, WriteNDJSONStream(streamed, ch))
+	assert.Equal(t, strings.SplitAfter(buf.String(), "\n")[0], streamed.String())
+}
+
+func TestWriteNDJSONGzip(t *testing.T) {
+	stats := []PcStatus{{Name: "16384", Pages: 2}, {Name: "16385", Pages: 4}}
+	plain := new(bytes.Buffer)
+	assert.Nil(t, WriteNDJSON(plain, stats))
+
+	buf := new(bytes.Buffer)
+	assert.Nil(t, WriteNDJSONGzip(buf, stats))
+	gr, err := gzip.NewReader(buf)
+	assert.Nil(t, err)
+	b, err := ioutil.ReadAll(gr)
+	assert.Nil(t, err)
+	assert.Equal(t, plain.String(), string(b))
+
+	buf.Reset()
+	assert.Nil(t, WriteJSONGzip(buf, nil))
+	gr, err = gzip.NewReader(buf)
+	assert.Nil(t, err)
+	b, err = ioutil.ReadAll(gr)
+	assert.Nil(t, err)
+	assert.Equal(t, "[]\n", string(b))
+}
+
+func TestFormatTable(t *testing.T) {
+	stats := []PcStatus{
+		{Name: "/data/base/5/16384", Size: 1288490189, Pages: 10, Cached: 5, Percent: 50},
+		{Name: "/data/base/5/16385", Size: 8192, Pages: 2, Cached: 2, Percent: 100},
+	}
+
+	buf := new(bytes.Buffer)
+	assert.Nil(t, FormatTable(buf, stats, TableOptions{SortBy: SortByPercent, MaxNameLen: 10}))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Equal(t, 3, len(lines))
+	assert.Contains(t, lines[1], "...5/16385")
+	assert.Contains(t, lines[1], "[##########] 100.00%")
+	assert.Contains(t, lines[2], "1.2G")
+	assert.Contains(t, lines[2], "[#####     ]")
+	assert.NotContains(t, lines[0], "RELATION")
+}
+
+func TestFormatTableRelName(t *testing.T) {
+	stats := []PcStatus{
+		{Name: "/data/base/5/16384", RelName: "public.orders", Size: 8192, Pages: 2, Cached: 1, Percent: 50},
+		{Name: "/data/base/5/16385", Size: 8192, Pages: 2, Cached: 2, Percent: 100},
+	}
+
+	buf := new(bytes.Buffer)
+	assert.Nil(t, FormatTable(buf, stats, TableOptions{SortBy: SortByName, RelName: true}))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Equal(t, 3, len(lines))
+	assert.True(t, strings.HasSuffix(lines[0], "RELATION"))
+	assert.True(t, strings.HasPrefix(lines[1], "/data/base/5/16384 "))
+	assert.True(t, strings.HasSuffix(lines[1], "public.orders"))
+	assert.Equal(t, "/data/base/5/16384", stats[0].Name)
+
+	stats[1].DirectIO = true
+	buf.Reset()
+	assert.Nil(t, FormatTable(buf, stats, TableOptions{SortBy: SortByName, DirectIO: true}))
+
+	lines = strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.True(t, strings.HasSuffix(lines[0], "DIRECT IO"))
+	assert.False(t, strings.HasSuffix(lines[1], "yes"))
+	assert.True(t, strings.HasSuffix(lines[2], "yes"))
+	assert.NotContains(t, lines[1], "public.orders")
+}
+
+func TestFormatGrouped(t *testing.T) {
+	now := time.Now()
+	stats := []PcStatus{
+		{Name: "/data/base/5/16384", Size: 8192, Pages: 2, Cached: 1, Percent: 50, Timestamp: now},
+		{Name: "/data/base/1/1259", Size: 8192, Pages: 2, Cached: 2, Percent: 100, Timestamp: now},
+		{Name: "/data/pg_wal/000000010000000000000001", Size: 8192, Pages: 2, Timestamp: now},
+	}
+
+	groups := GroupByDatabase(stats, func(name string) string {
+		switch {
+		case strings.Contains(name, "/base/5/"):
+			return "app"
+		case strings.Contains(name, "/base/1/"):
+			return "template1"
+		}
+		return ""
+	})
+	assert.Equal(t, 3, len(groups))
+	assert.Equal(t, 1, len(groups[UnknownDatabase]))
+
+	buf := new(bytes.Buffer)
+	assert.Nil(t, FormatGrouped(buf, groups, TableOptions{}))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Equal(t, 11, len(lines))
+	assert.True(t, strings.HasPrefix(lines[1], "[app]"))
+	assert.True(t, strings.HasPrefix(lines[3], "SUBTOTAL app"))
+	assert.True(t, strings.HasPrefix(lines[7], "[unknown]"))
+	assert.True(t, strings.HasPrefix(lines[10], TotalName))
+	assert.Contains(t, lines[10], " 50.00%")
+}
+
+func TestWriteCSV(t *testing.T) {
+	mtime := time.Date(2023, 3, 12, 10, 52, 0, 0, time.UTC)
+	stats := []PcStatus{
+		{Name: "a,b", Size: 8192, Pages: 2, Cached: 1, Uncached: 1, Percent: 50, Mtime: mtime},
+	}
+
+	buf := new(bytes.Buffer)
+	assert.Nil(t, WriteCSV(buf, stats))
+	assert.Equal(t, "filename,size,pages,cached,uncached,percent,mtime\n"+
+		"\"a,b\",8192,2,1,1,50.000,2023-03-12T10:52:00Z\n", buf.String())
+
+	stats[0].RelName = "public.orders"
+	buf.Reset()
+	assert.Nil(t, WriteCSV(buf, stats, CSVOptions{RelName: true}))
+	assert.Equal(t, "filename,size,pages,cached,uncached,percent,mtime,rel_name\n"+
+		"\"a,b\",8192,2,1,1,50.000,2023-03-12T10:52:00Z,public.orders\n", buf.String())
+
+	stats[0].DirectIO = true
+	buf.Reset()
+	assert.Nil(t, WriteCSV(buf, stats, CSVOptions{DirectIO: true}))
+	assert.Equal(t, "filename,size,pages,cached,uncached,percent,mtime,direct_io\n"+
+		"\"a,b\",8192,2,1,1,50.000,2023-03-12T10:52:00Z,true\n", buf.String())
+}
+
+func TestWriteYAML(t *testing.T) {
+	mtime := time.Date(2023, 3, 12, 10, 52, 0, 0, time.UTC)
+	stats := []PcStatus{
+		{Name: "base/5/16384", Size: 8192, Pages: 2, Cached: 1, Mtime: mtime},
+	}
+
+	buf := new(bytes.Buffer)
+	assert.Nil(t, WriteYAML(buf, stats))
+	out := buf.String()
+	assert.Contains(t, out, "- filename: base/5/16384\n")
+	assert.Contains(t, out, "  cached_bytes: 0\n")
+	assert.Contains(t, out, "  mtime: 2023-03-12T10:52:00Z\n")
+
+	buf.Reset()
+	assert.Nil(t, WriteYAML(buf, nil))
+	assert.Equal(t, "[]\n", buf.String())
+}
+
+func TestWriteJSONEnvelope(t *testing.T) {
+	buf := new(bytes.Buffer)
+	assert.Nil(t, WriteJSONEnvelope(buf, []PcStatus{{Name: "16384", Pages: 2}}))
+
+	var env JSONEnvelope
+	assert.Nil(t, json.Unmarshal(buf.Bytes(), &env))
+	assert.Equal(t, JSONVersion, env.Version)
+	assert.False(t, env.GeneratedAt.IsZero())
+	assert.Equal(t, 1, len(env.Statuses))
+	assert.Equal(t, "16384", env.Statuses[0].Name)
+	assert.Equal(t, os.Getpagesize(), env.PageSize)
+	hostname, _ := os.Hostname()
+	assert.Equal(t, hostname, env.Hostname)
+	if runtime.GOOS == "linux" {
+		assert.NotEqual(t, "", env.KernelRelease)
+	}
+
+	buf.Reset()
+	assert.Nil(t, WriteJSONEnvelope(buf, nil))
+	assert.Contains(t, buf.String(), `"statuses":[]`)
+}
+
+func TestSnapshot(t *testing.T) {
+	stats := []PcStatus{{Name: "16384", Pages: 4, Cached: 2, Percent: 50}, {Name: "16385", Pages: 2}}
+	buf := new(bytes.Buffer)
+	assert.Nil(t, SaveSnapshot(buf, stats))
+
+	loaded, err := LoadSnapshot(buf)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(loaded))
+	assert.Equal(t, stats[0].Name, loaded[0].Name)
+	assert.Equal(t, stats[0].Percent, loaded[0].Percent)
+	assert.Equal(t, 2, TopN(loaded, 1, SortByPercent)[0].Cached)
+
+	_, err = LoadSnapshot(strings.NewReader(`{"version":99,"statuses":[]}`))
+	assert.NotNil(t, err)
+	_, err = LoadSnapshot(strings.NewReader(`[{"filename":"16384"}]`))
+	assert.NotNil(t, err)
+}
@@ -17,9 +17,11 @@ package pcstats
  */
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
+	"syscall"
 	"time"
 )
 
@@ -27,58 +29,628 @@ import (
 // Bytes: size of the file (from os.File.Stat())
 // Pages: array of booleans: true if cached, false otherwise
 type PcStatus struct {
-	Name      string    `json:"filename"`  // file name as specified on command line
-	Size      int64     `json:"size"`      // file size in bytes
-	Timestamp time.Time `json:"timestamp"` // time right before calling mincore
-	Mtime     time.Time `json:"mtime"`     // last modification time of the file
-	Pages     int       `json:"pages"`     // total memory pages
-	Cached    int       `json:"cached"`    // number of pages that are cached
-	Uncached  int       `json:"uncached"`  // number of pages that are not cached
-	Percent   float64   `json:"percent"`   // percentage of pages cached
+	Name             string        `json:"filename" yaml:"filename"`                       // file name as specified on command line
+	Size             int64         `json:"size" yaml:"size"`                               // file size in bytes
+	Timestamp        time.Time     `json:"timestamp" yaml:"timestamp"`                     // time right before calling mincore
+	Mtime            time.Time     `json:"mtime" yaml:"mtime"`                             // last modification time of the file
+	Pages            int           `json:"pages" yaml:"pages"`                             // total memory pages
+	Cached           int           `json:"cached" yaml:"cached"`                           // number of pages that are cached
+	Uncached         int           `json:"uncached" yaml:"uncached"`                       // number of pages that are not cached
+	Percent          float64       `json:"percent" yaml:"percent"`                         // percentage of pages cached, 0 for an empty file
+	Dirty            int           `json:"dirty" yaml:"dirty"`                             // number of kernel pages that are cached and dirty
+	IdleCached       int           `json:"idle_cached" yaml:"idle_cached"`                 // number of kernel pages that are cached and idle since MarkIdle
+	Truncated        bool          `json:"truncated" yaml:"truncated"`                     // the file shrank while scanning, the counts are approximate
+	CachedDelta      int           `json:"cached_delta" yaml:"cached_delta"`               // change of cached pages against the previous sample of WatchPcStatus
+	Rewritten        bool          `json:"rewritten" yaml:"rewritten"`                     // the file replaced another of the same WatchFile.Key since the previous sample, such as a relation rewritten by VACUUM FULL
+	Sparse           int           `json:"sparse" yaml:"sparse"`                           // number of uncached pages in holes, which are excluded from Pages
+	Skipped          bool          `json:"skipped" yaml:"skipped"`                         // the file isn't scanned, the counts are from the previous scan or 0 over MaxFileSize
+	RelName          string        `json:"rel_name" yaml:"rel_name"`                       // qualified name of the postgresql relation, such as public.orders, when resolved
+	RelPages         int           `json:"rel_pages" yaml:"rel_pages"`                     // relpages of pg_class of the relation of the main fork, when annotated
+	CachedVsRelPages float64       `json:"cached_vs_rel_pages" yaml:"cached_vs_rel_pages"` // CachedBlocks of all the segments of the relation against RelPages, above 1 when the relation grew since analyzed
+	DirectIO         bool          `json:"direct_io" yaml:"direct_io"`                     // the server reads the file with O_DIRECT, bypassing the page cache, when annotated
+	SkipReason       string        `json:"skip_reason" yaml:"skip_reason"`                 // why the file isn't scanned, one of the Skip consts
+	Error            string        `json:"error,omitempty" yaml:"error,omitempty"`         // the error of the scan of GetPcStatusBatch and ScanDir, "" on success
+	Fork             string        `json:"fork" yaml:"fork"`                               // fork of the postgresql relation, main, fsm, vm or init, empty for other files
+	Kind             string        `json:"kind,omitempty" yaml:"kind,omitempty"`           // the kind of the file by FileKind, with ScanOptions.LabelKinds
+	Allocated        int64         `json:"allocated" yaml:"allocated"`                     // allocated size in bytes from st_blocks, with Options.IncludeAllocated or PhysicalPercent
+	CachedBeyondEOF  int           `json:"cached_beyond_eof" yaml:"cached_beyond_eof"`     // number of cached pages beyond the end of the file within Allocated
+	CachedBytes      int64         `json:"cached_bytes" yaml:"cached_bytes"`               // bytes of the cached pages, the partial last page only counts up to Size
+	CachedBlocks     int           `json:"cached_blocks" yaml:"cached_blocks"`             // number of postgresql blocks of Options.BlockSize in the cached pages
+	Device           uint64        `json:"device" yaml:"device"`                           // device of the file, with Inode identifies the hardlinks
+	Inode            uint64        `json:"inode" yaml:"inode"`                             // inode number of the file
+	ResidencyHash    string        `json:"residency_hash" yaml:"residency_hash"`           // sha-256 of the packed residency, with Options.HashResidency
+	Offset           int64         `json:"offset" yaml:"offset"`                           // start of the range scanned with Options.Offset
+	Length           int64         `json:"length" yaml:"length"`                           // length of the range scanned with Options.Length, 0 for the whole file
+	Approximate      bool          `json:"approximate" yaml:"approximate"`                 // Cached is extrapolated from the windows sampled by Options.Sample, or the tail is assumed cold by StopIfCold
+	WeightedPercent  float64       `json:"weighted_percent" yaml:"weighted_percent"`       // percentage of the weight of the cached pages by Options.Weight, Percent without it
+	Age              time.Duration `json:"age" yaml:"age"`                                 // time since the last modification at Timestamp, nanoseconds in JSON
 }
 
-func GetPcStatus(fname string, filter func(f *os.File) error) (PcStatus, error) {
-	pcs := PcStatus{Name: fname}
+// the reasons of PcStatus.SkipReason.
+const (
+	SkipUnchanged  = "unchanged"         // Options.TrustUnchanged
+	SkipTooLarge   = "too large"         // Options.MaxFileSize
+	SkipPermission = "permission denied" // BatchOptions.SkipPermissionDenied
+)
+
+// the errors of GetPcStatus that can be told apart by errors.Is, such as
+// for categorizing the failures of a batch scan. the errors of open are
+// wrapped, so errors.Is(err, ErrPermission) and errors.Is(err,
+// os.ErrNotExist) also work for them.
+var (
+	// ErrFileVanished is returned when the file is removed while scanning it.
+	ErrFileVanished = errors.New("file vanished while scanning")
+
+	// ErrPermission is returned when the file can't be opened for read.
+	ErrPermission = os.ErrPermission
+
+	// ErrIsDirectory is returned for the directories, see ScanDir for them.
+	ErrIsDirectory = errors.New("file is a directory")
+
+	// ErrNotRegular is returned for the files which are neither regular
+	// files nor block devices, such as sockets, pipes and char devices.
+	ErrNotRegular = errors.New("file is not a regular file or block device")
+
+	// ErrTimeout is returned for the files whose scan exceeds
+	// BatchOptions.PerFileTimeout.
+	ErrTimeout = errors.New("scan timed out")
+
+	// ErrUnsupportedPlatform is returned on the platforms without mincore,
+	// such as windows.
+	ErrUnsupportedPlatform = errors.New("page cache status is not supported on this platform")
+)
+
+func GetPcStatus(fname string, filter func(f *os.File) error, opts ...Options) (PcStatus, error) {
+	return GetPcStatusContext(context.Background(), fname, filter, opts...)
+}
+
+// GetPcStatusContext is the same as GetPcStatus, but gives up with ctx.Err()
+// once ctx is done, it's checked before the open and between the mincore
+// windows of the file.
+func GetPcStatusContext(ctx context.Context, fname string, filter func(f *os.File) error, opts ...Options) (PcStatus, error) {
+	pcs, _, err := getPcStatus(ctx, fname, filter, false, getOptions(opts))
+	return pcs, err
+}
+
+// GetPcStatusWithBitmap is the same as GetPcStatus, and also returns the
+// per-page cached bitmap of the file, see GetFileMincoreBitmap for how the
+// page index maps to the file offset. the bitmap is only allocated here,
+// so GetPcStatus is cheaper for huge files.
+func GetPcStatusWithBitmap(fname string, filter func(f *os.File) error, opts ...Options) (PcStatus, []bool, error) {
+	return getPcStatus(context.Background(), fname, filter, true, getOptions(opts))
+}
+
+// GetPcStatusFromFile is the same as GetPcStatus, but scans the file that is
+// already open, the caller owns f, it isn't closed here. a file without a
+// name, such as of ReceiveFile or os.NewFile(fd, ""), is named `fd:<fd>`.
+func GetPcStatusFromFile(f *os.File, filter func(f *os.File) error, opts ...Options) (PcStatus, error) {
+	pcs, _, err := getFileStatus(context.Background(), f, filter, false, getOptions(opts))
+	if pcs.Name == "" {
+		pcs.Name = fmt.Sprintf("fd:%d", f.Fd())
+	}
+	return pcs, err
+}
+
+// ChainFilters combines the filters of GetPcStatus into one, which runs them
+// in order and returns the first error, the nil filters are skipped.
+func ChainFilters(filters ...func(f *os.File) error) func(f *os.File) error {
+	return func(f *os.File) error {
+		for _, filter := range filters {
+			if filter == nil {
+				continue
+			}
+			if err := filter(f); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
 
-	f, err := os.Open(fname)
+func getPcStatus(ctx context.Context, fname string, filter func(f *os.File) error, withBitmap bool, opt Options) (PcStatus, []bool, error) {
+	pcs := PcStatus{Name: fname, Fork: RelationFork(fname)}
+	if !platformSupported {
+		return pcs, nil, ErrUnsupportedPlatform
+	}
+	if err := ctx.Err(); err != nil {
+		return pcs, nil, err
+	}
+
+	// check before the open, which blocks on a fifo without writers.
+	if finfo, err := opt.statFile(fname); err == nil {
+		if err := checkFileMode(finfo); err != nil {
+			return pcs, nil, err
+		}
+	}
+	return openFileStatus(ctx, fname, filter, withBitmap, opt)
+}
+
+// openFileStatus is getPcStatus once the mode of the file is checked.
+func openFileStatus(ctx context.Context, fname string, filter func(f *os.File) error, withBitmap bool, opt Options) (PcStatus, []bool, error) {
+	f, err := opt.openFile(fname)
 	if err != nil {
-		return pcs, fmt.Errorf("could not open file for read: %v", err)
+		return PcStatus{Name: fname, Fork: RelationFork(fname)}, nil, fmt.Errorf("could not open file for read: %w", err)
 	}
 	defer f.Close()
 
-	if err := filter(f); err != nil {
-		return pcs, err
+	pcs, bitmap, err := getFileStatus(ctx, f, filter, withBitmap, opt)
+	pcs.Name, pcs.Fork = fname, RelationFork(fname)
+	return pcs, bitmap, err
+}
+
+// openFile is openFile of fname, in the root of MountNamespacePID if set.
+func (o Options) openFile(fname string) (*os.File, error) {
+	if o.MountNamespacePID <= 0 {
+		return openFile(fname, o.NoAtime)
+	}
+	if o.NoAtime && oNoAtime != 0 {
+		f, err := openInRoot(o.MountNamespacePID, fname, os.O_RDONLY|oNoAtime)
+		if !errors.Is(err, syscall.EPERM) {
+			return f, err
+		}
+	}
+	return openInRoot(o.MountNamespacePID, fname, os.O_RDONLY)
+}
+
+// statFile is os.Stat of fname, in the root of MountNamespacePID if set.
+func (o Options) statFile(fname string) (os.FileInfo, error) {
+	if o.MountNamespacePID <= 0 {
+		return os.Stat(fname)
+	}
+	return statInRoot(o.MountNamespacePID, fname)
+}
+
+// openFile opens the file for read, with oNoAtime if noAtime is set and the
+// platform has it, or as os.Open when O_NOATIME is refused for the owner.
+func openFile(fname string, noAtime bool) (*os.File, error) {
+	if noAtime && oNoAtime != 0 {
+		f, err := os.OpenFile(fname, os.O_RDONLY|oNoAtime, 0)
+		if !errors.Is(err, syscall.EPERM) {
+			return f, err
+		}
+	}
+	return os.Open(fname)
+}
+
+func getFileStatus(ctx context.Context, f *os.File, filter func(f *os.File) error, withBitmap bool, opt Options) (PcStatus, []bool, error) {
+	fname := f.Name()
+	pcs := PcStatus{Name: fname, Fork: RelationFork(fname)}
+	if !platformSupported {
+		return pcs, nil, ErrUnsupportedPlatform
+	}
+
+	if filter != nil {
+		if err := filter(f); err != nil {
+			return pcs, nil, err
+		}
 	}
 
-	// TEST TODO: verify behavior when the file size is changing quickly
-	// while this function is running. I assume that the size parameter to
-	// mincore will prevent overruns of the output vector, but it's not clear
-	// what will be in there when the file is truncated between here and the
-	// mincore() call.
 	finfo, err := f.Stat()
 	if err != nil {
-		return pcs, fmt.Errorf("could not stat file: %v", err)
+		return pcs, nil, fmt.Errorf("could not stat file: %w", err)
 	}
-	if finfo.IsDir() {
-		return pcs, errors.New("file is a directory")
+	if err := checkFileMode(finfo); err != nil {
+		return pcs, nil, err
 	}
 
 	pcs.Size = finfo.Size()
 	pcs.Timestamp = time.Now()
 	pcs.Mtime = finfo.ModTime()
+	pcs.Age = pcs.Timestamp.Sub(pcs.Mtime)
+	pcs.Device, pcs.Inode = fileID(finfo)
+
+	if !withBitmap && opt.Bitmap == nil && opt.unchanged(pcs.Size, pcs.Mtime) {
+		prev := *opt.Previous
+		prev.Skipped = true
+		prev.SkipReason = SkipUnchanged
+		return prev, nil, nil
+	}
+
+	// the size of block device from stat is 0, only report its real size.
+	if isBlockDevice(finfo) {
+		pcs.Size, err = getBlockDeviceSize(f)
+		if err != nil || !opt.BlockDeviceResidency {
+			return pcs, nil, err
+		}
+	}
+
+	if opt.tooLarge(pcs.Size) {
+		pcs.Skipped = true
+		pcs.SkipReason = SkipTooLarge
+		return pcs, nil, nil
+	}
+	if isBlockDevice(finfo) {
+		return pcs, nil, getBlockDeviceStatus(ctx, f, &pcs, opt)
+	}
+
+	if opt.hasRange() && !withBitmap {
+		if err := getRangeStatus(ctx, f, &pcs, opt); err != nil {
+			return pcs, nil, checkVanished(fname, err)
+		}
+		return pcs, nil, nil
+	}
+
+	// the bitmap is needed to know whether the pages of holes are cached.
+	var (
+		bitmap       []bool
+		dirtyCounted bool
+	)
+
+	bm := opt.Bitmap
+	if bm == nil && (opt.HashResidency || opt.Weight != nil) {
+		bm = new(Bitmap)
+	}
+	if withBitmap || opt.SkipHoles {
+		bitmap, err = getFileMincoreBitmap(ctx, f, pcs.Size, opt.pageSize())
+		for _, cached := range bitmap {
+			if cached {
+				pcs.Cached++
+			}
+		}
+		pcs.Pages = len(bitmap)
+	} else if opt.Sample > 1 && bm == nil {
+		var mincore *Mincore
+		mincore, pcs.Approximate, err = getSampledMincore(ctx, f, pcs.Size, opt.pageSize(), opt.Sample, opt.SampleSeed)
+		if mincore != nil {
+			pcs.Cached = int(mincore.Cached)
+			pcs.Pages = int(mincore.Cached) + int(mincore.Miss)
+		}
+	} else if opt.StopIfCold > 0 && bm == nil {
+		var mincore *Mincore
+		mincore, pcs.Approximate, err = getColdMincore(ctx, f, pcs.Size, opt.pageSize(), opt.StopIfCold)
+		if mincore != nil {
+			pcs.Cached = int(mincore.Cached)
+			pcs.Pages = int(mincore.Cached) + int(mincore.Miss)
+		}
+	} else {
+		var mincore *Mincore
+		mincore, err = getFileMincore(ctx, f, pcs.Size, opt.pageSize(), bm)
+		if mincore != nil {
+			pcs.Cached = int(mincore.Cached)
+			pcs.Pages = int(mincore.Cached) + int(mincore.Miss)
+			if mincore.hasDirty && opt.IncludeDirty {
+				pcs.Dirty = int(mincore.Dirty)
+				dirtyCounted = true
+			}
+		}
+	}
+	if err != nil {
+		return pcs, nil, checkVanished(fname, err)
+	}
+
+	// the file may be truncated by the VACUUM or DROP of postgresql while
+	// running mincore, the pages beyond the new size are meaningless.
+	if err := checkTruncated(f, fname, &pcs, bitmap, opt.pageSize()); err != nil {
+		return pcs, nil, err
+	}
+	if bitmap != nil {
+		bitmap = bitmap[:pcs.Pages]
+	}
+	if bm != nil {
+		fillBitmap(bm, &pcs, bitmap)
+		if opt.HashResidency {
+			pcs.ResidencyHash = bm.Hash()
+		}
+	}
 
-	mincore, err := GetFileMincore(f, finfo.Size())
+	pcs.CachedBytes, err = getCachedBytes(ctx, f, pcs, bitmap, bm, opt.pageSize())
 	if err != nil {
-		return pcs, err
+		return pcs, nil, checkVanished(fname, err)
+	}
+
+	if opt.IncludeDirty && !dirtyCounted && pcs.Cached != 0 {
+		pcs.Dirty = getDirtyPages(ctx, f, pcs.Size)
+	}
+	if opt.IncludeIdle && pcs.Cached != 0 {
+		pcs.IdleCached = getIdlePages(ctx, f, pcs.Size)
+	}
+
+	if opt.IncludeAllocated || opt.PhysicalPercent {
+		pcs.Allocated = allocatedSize(finfo)
+	}
+	if opt.IncludeAllocated {
+		pcs.CachedBeyondEOF, err = getCachedBeyondEOF(ctx, f, pcs.Size, pcs.Allocated, opt.pageSize())
+		if err != nil {
+			return pcs, nil, checkVanished(fname, err)
+		}
+	}
+
+	if opt.SkipHoles {
+		pcs.Sparse, err = countSparsePages(f, pcs.Size, opt.pageSize(), bitmap)
+		if err != nil {
+			return pcs, nil, err
+		}
+		pcs.Pages -= pcs.Sparse
+	}
+
+	pcs.Uncached = pcs.Pages - pcs.Cached
+	if pcs.Pages != 0 {
+		pcs.Percent = (float64(pcs.Cached) / float64(pcs.Pages)) * 100.00
+	}
+	if opt.PhysicalPercent && pcs.Allocated > 0 {
+		pcs.Percent = physicalPercent(pcs.CachedBytes, pcs.Allocated)
+	}
+	pcs.WeightedPercent = pcs.Percent
+	pcs.CachedBlocks = PagesToBlocks(pcs.Cached, opt.pageSize(), opt.BlockSize)
+	if opt.Weight != nil {
+		pcs.WeightedPercent = weightedPercent(bm, opt.Weight)
+	}
+
+	if !withBitmap {
+		return pcs, nil, nil
+	}
+	return pcs, bitmap, nil
+}
+
+// weightedPercent returns the percentage of the weight of the cached pages of
+// bm over the weight of all the pages, 0 if the total weight is 0.
+func weightedPercent(bm *Bitmap, weight func(pageIndex int) float64) float64 {
+	var cached, total float64
+	for i := 0; i < bm.Len(); i++ {
+		w := weight(i)
+		total += w
+		if bm.Get(i) {
+			cached += w
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return cached / total * 100.00
+}
+
+// getBlockDeviceStatus counts the cached pages of the block device into pcs,
+// it leaves the counts 0 when the device can't be mapped.
+func getBlockDeviceStatus(ctx context.Context, f *os.File, pcs *PcStatus, opt Options) error {
+	mincore, err := getFileMincore(ctx, f, pcs.Size, opt.pageSize(), nil)
+	if errors.Is(err, ErrPermission) || errors.Is(err, syscall.ENODEV) {
+		return nil
 	}
-	if mincore == nil {
-		return pcs, nil
+	if err != nil {
+		return err
 	}
 
 	pcs.Cached = int(mincore.Cached)
-	pcs.Pages = int(mincore.Cached) + int(mincore.Miss)
-	pcs.Uncached = int(mincore.Miss)
+	pcs.Pages = int(mincore.Cached + mincore.Miss)
+	pcs.Uncached = pcs.Pages - pcs.Cached
+	pcs.CachedBytes = int64(pcs.Cached) * int64(opt.pageSize())
+	if pcs.Pages != 0 {
+		pcs.Percent = (float64(pcs.Cached) / float64(pcs.Pages)) * 100.00
+	}
+	pcs.WeightedPercent = pcs.Percent
+	pcs.CachedBlocks = PagesToBlocks(pcs.Cached, opt.pageSize(), opt.BlockSize)
+	return nil
+}
+
+// getRangeStatus counts the pages of the range of Options.Offset and
+// Options.Length of the file into pcs.
+func getRangeStatus(ctx context.Context, f *os.File, pcs *PcStatus, opt Options) error {
+	align := int64(opt.pageSize())
+	if kpsz := int64(os.Getpagesize()); kpsz > align {
+		align = kpsz
+	}
+
+	end := pcs.Size
+	if opt.Length > 0 && opt.Offset+opt.Length < end {
+		end = opt.Offset + opt.Length
+	}
+	pcs.Offset = opt.Offset
+	if end > opt.Offset {
+		pcs.Length = end - opt.Offset
+	}
+
+	start := opt.Offset / align * align
+	if start < end {
+		mincore, err := getRangeMincore(ctx, f, start, end, opt.pageSize())
+		if err != nil {
+			return err
+		}
+		pcs.Cached = int(mincore.Cached)
+		pcs.Pages = int(mincore.Cached + mincore.Miss)
+	}
+
+	pcs.Uncached = pcs.Pages - pcs.Cached
+	pcs.CachedBytes = min64(int64(pcs.Cached)*int64(opt.pageSize()), end-start)
+	if pcs.Pages != 0 {
+		pcs.Percent = (float64(pcs.Cached) / float64(pcs.Pages)) * 100.00
+	}
+	pcs.WeightedPercent = pcs.Percent
+	pcs.CachedBlocks = PagesToBlocks(pcs.Cached, opt.pageSize(), opt.BlockSize)
+	return nil
+}
+
+// physicalPercent is the percent of the cached bytes in the physical size,
+// capped at 100 as the page cache holds the decompressed pages, which may
+// be more than the compressed extents.
+func physicalPercent(cachedBytes, physicalSize int64) float64 {
+	percent := float64(cachedBytes) / float64(physicalSize) * 100.00
+	if percent > 100 {
+		return 100
+	}
+	return percent
+}
+
+// DefaultBlockSize is the default BLCKSZ of postgresql, the size of the
+// blocks of pg_buffercache.
+const DefaultBlockSize = 8192
+
+// PagesToBlocks converts the number of pages of pageSize to the number of
+// postgresql blocks of blockSize, such as 6 cached pages of 4KB to 3 blocks
+// of 8KB, 0 sizes mean the kernel page size and DefaultBlockSize. when the
+// block size isn't a multiple of the page size, the blocks are rounded down
+// to the ones the bytes of the pages can cover.
+func PagesToBlocks(pages int, pageSize, blockSize int) int {
+	if pageSize <= 0 {
+		pageSize = os.Getpagesize()
+	}
+	if blockSize <= 0 {
+		blockSize = DefaultBlockSize
+	}
+	return int(int64(pages) * int64(pageSize) / int64(blockSize))
+}
+
+// getCachedBytes counts the bytes of the cached pages, the last page of the
+// file is usually partial, so only the bytes up to the size are counted
+// when it's cached, which adds up for thousands of tiny catalogs.
+func getCachedBytes(ctx context.Context, f *os.File, pcs PcStatus, bitmap []bool, bm *Bitmap, pageSize int) (int64, error) {
+	psz := int64(pageSize)
+	cached := int64(pcs.Cached) * psz
+
+	tail := pcs.Size % psz
+	if tail == 0 || pcs.Cached == 0 {
+		return cached, nil
+	}
+
+	var (
+		last       = pcs.Pages - 1
+		lastCached bool
+		err        error
+	)
+	switch {
+	case bitmap != nil:
+		lastCached = bitmap[last]
+	case bm != nil:
+		lastCached = bm.Get(last)
+	case pcs.Cached == pcs.Pages:
+		lastCached = true
+	default:
+		lastCached, err = isLastPageCached(ctx, f, pcs.Size, pageSize)
+	}
+
+	if lastCached {
+		cached -= psz - tail
+	}
+	return cached, err
+}
+
+// checkTruncated stats the file again after the mincore, if the size shrank,
+// clamp the pages to the new size and mark the status as truncated.
+func checkTruncated(f *os.File, fname string, pcs *PcStatus, bitmap []bool, pageSize int) error {
+	if err := checkVanished(fname, nil); err != nil {
+		return err
+	}
+
+	finfo, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("could not stat file: %v", err)
+	}
+	if finfo.Size() >= pcs.Size {
+		return nil
+	}
+
+	pcs.Size = finfo.Size()
+	pcs.Truncated = true
+
+	pages := int((pcs.Size + int64(pageSize) - 1) / int64(pageSize))
+	if pages >= pcs.Pages {
+		return nil
+	}
+	pcs.Pages = pages
+
+	if bitmap == nil {
+		// no bitmap to know which pages were dropped, approximate it.
+		if pcs.Cached > pages {
+			pcs.Cached = pages
+		}
+		return nil
+	}
+
+	pcs.Cached = 0
+	for _, cached := range bitmap[:pages] {
+		if cached {
+			pcs.Cached++
+		}
+	}
+	return nil
+}
+
+// fillBitmap fills bm from the bitmap, or truncates bm filled by the mincore
+// to the pages of the truncated file, whose cached pages are known exactly.
+func fillBitmap(bm *Bitmap, pcs *PcStatus, bitmap []bool) {
+	if bitmap == nil {
+		bm.truncate(pcs.Pages)
+		pcs.Cached = bm.PopCount()
+		return
+	}
 
-	pcs.Percent = (float64(pcs.Cached) / float64(pcs.Pages)) * 100.00
-	return pcs, nil
+	bm.reset(len(bitmap))
+	for i, cached := range bitmap {
+		if cached {
+			bm.Set(i, true)
+		}
+	}
+}
+
+// getCachedBeyondEOF counts the cached pages of the mapping of the allocated
+// size, that start at or beyond the end of the file.
+func getCachedBeyondEOF(ctx context.Context, f *os.File, size, allocated int64, pageSize int) (int, error) {
+	psz := int64(pageSize)
+	start := (size + psz - 1) / psz
+	if allocated <= start*psz {
+		return 0, nil
+	}
+
+	vec, err := getMincoreVec(ctx, f, allocated, pageSize)
+	if err != nil {
+		return 0, err
+	}
+
+	var cached int
+	for _, b := range vec[start:] {
+		if isResident(b) {
+			cached++
+		}
+	}
+	return cached, nil
+}
+
+// checkVanished returns ErrFileVanished if the file is removed, the files
+// without a name, such as the ones from os.NewFile, are never vanished.
+func checkVanished(fname string, err error) error {
+	if fname == "" {
+		return err
+	}
+	if _, serr := os.Stat(fname); os.IsNotExist(serr) {
+		return ErrFileVanished
+	}
+	return err
+}
+
+// getFileSize returns the size of regular files and block devices.
+func getFileSize(f *os.File) (int64, error) {
+	finfo, err := f.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("could not stat file: %w", err)
+	}
+	if err := checkFileMode(finfo); err != nil {
+		return 0, err
+	}
+
+	if isBlockDevice(finfo) {
+		return getBlockDeviceSize(f)
+	}
+	return finfo.Size(), nil
+}
+
+// checkFileMode only accepts the regular files and block devices.
+func checkFileMode(finfo os.FileInfo) error {
+	switch {
+	case finfo.IsDir():
+		return ErrIsDirectory
+	case finfo.Mode().IsRegular(), isBlockDevice(finfo):
+		return nil
+	}
+	return ErrNotRegular
+}
+
+func isBlockDevice(finfo os.FileInfo) bool {
+	mode := finfo.Mode()
+	return mode&os.ModeDevice != 0 && mode&os.ModeCharDevice == 0
+}
+
+func min64(x, y int64) int64 {
+	if x < y {
+		return x
+	}
+	return y
 }
@@ -0,0 +1,47 @@
+package pcstats
+
+import (
+	"fmt"
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	seekData = unix.SEEK_DATA
+	seekHole = unix.SEEK_HOLE
+
+	// no O_NOATIME
+	oNoAtime = 0
+)
+
+// from <sys/disk.h>
+const (
+	dkiocGetBlockSize  = 0x40046418
+	dkiocGetBlockCount = 0x40086419
+)
+
+// MINCORE_INCORE of <sys/mman.h>
+const mincoreIncore = 0x1
+
+// the size of a block device is the block count multiplied by the block
+// size, from the DKIOCGETBLOCKCOUNT and DKIOCGETBLOCKSIZE ioctls.
+func getBlockDeviceSize(f *os.File) (int64, error) {
+	var (
+		blockSize  uint32
+		blockCount uint64
+	)
+
+	_, errno := syscallRetry(unix.SYS_IOCTL, f.Fd(), uintptr(dkiocGetBlockSize), uintptr(unsafe.Pointer(&blockSize)))
+	if errno != 0 {
+		return 0, fmt.Errorf("ioctl DKIOCGETBLOCKSIZE failed: %v", errno)
+	}
+
+	_, errno = syscallRetry(unix.SYS_IOCTL, f.Fd(), uintptr(dkiocGetBlockCount), uintptr(unsafe.Pointer(&blockCount)))
+	if errno != 0 {
+		return 0, fmt.Errorf("ioctl DKIOCGETBLOCKCOUNT failed: %v", errno)
+	}
+
+	return int64(blockCount) * int64(blockSize), nil
+}
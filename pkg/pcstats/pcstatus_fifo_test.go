@@ -0,0 +1,26 @@
+//go:build !windows
+// +build !windows
+
+package pcstats
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPcStatusNotRegular(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pgcacher")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	fifo := dir + "/fifo"
+	assert.Nil(t, syscall.Mkfifo(fifo, 0644))
+
+	_, errs := GetPcStatusBatch([]string{fifo}, BatchOptions{})
+	assert.True(t, errors.Is(errs[0], ErrNotRegular))
+}
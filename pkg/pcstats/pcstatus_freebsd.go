@@ -0,0 +1,33 @@
+package pcstats
+
+import (
+	"fmt"
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	seekData = unix.SEEK_DATA
+	seekHole = unix.SEEK_HOLE
+
+	// MINCORE_INCORE of <sys/mman.h>, the other bits of the vector are
+	// MINCORE_REFERENCED, MINCORE_MODIFIED and the superpage flags.
+	mincoreIncore = 0x1
+
+	// no O_NOATIME
+	oNoAtime = 0
+)
+
+// the size of a disk device from stat is always 0, so ask the kernel for it
+// via the DIOCGMEDIASIZE ioctl.
+func getBlockDeviceSize(f *os.File) (int64, error) {
+	var size int64
+	_, errno := syscallRetry(unix.SYS_IOCTL, f.Fd(), uintptr(unix.DIOCGMEDIASIZE), uintptr(unsafe.Pointer(&size)))
+	if errno != 0 {
+		return 0, fmt.Errorf("ioctl DIOCGMEDIASIZE failed: %v", errno)
+	}
+
+	return size, nil
+}
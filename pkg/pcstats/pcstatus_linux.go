@@ -0,0 +1,30 @@
+package pcstats
+
+import (
+	"fmt"
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	seekData = unix.SEEK_DATA
+	seekHole = unix.SEEK_HOLE
+
+	mincoreIncore = 0x1
+
+	oNoAtime = unix.O_NOATIME
+)
+
+// the size of a block device from stat is always 0, so ask the kernel
+// for it via the BLKGETSIZE64 ioctl.
+func getBlockDeviceSize(f *os.File) (int64, error) {
+	var size uint64
+	_, errno := syscallRetry(unix.SYS_IOCTL, f.Fd(), uintptr(unix.BLKGETSIZE64), uintptr(unsafe.Pointer(&size)))
+	if errno != 0 {
+		return 0, fmt.Errorf("ioctl BLKGETSIZE64 failed: %v", errno)
+	}
+
+	return int64(size), nil
+}
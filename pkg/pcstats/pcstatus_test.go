@@ -0,0 +1,703 @@
+package pcstats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEmptyFilePercent(t *testing.T) {
+	f, err := ioutil.TempFile("", "pgcacher")
+	assert.Nil(t, err)
+	defer os.Remove(f.Name())
+	f.Close()
+
+	pcs, err := GetPcStatus(f.Name(), nil)
+	assert.Nil(t, err)
+	assert.False(t, math.IsNaN(pcs.Percent))
+	assert.Equal(t, 0.0, pcs.Percent)
+	assert.Equal(t, 0, pcs.Pages)
+}
+
+func TestSparseFile(t *testing.T) {
+	f, err := ioutil.TempFile("", "pgcacher")
+	assert.Nil(t, err)
+	defer os.Remove(f.Name())
+
+	psz := os.Getpagesize()
+	assert.Nil(t, f.Truncate(int64(64*psz)))
+	_, err = f.WriteAt(make([]byte, psz), 0)
+	assert.Nil(t, err)
+	f.Close()
+
+	pcs, err := GetPcStatus(f.Name(), nil, Options{SkipHoles: true})
+	assert.Nil(t, err)
+	assert.Equal(t, 63, pcs.Sparse)
+	assert.Equal(t, 1, pcs.Pages)
+	assert.Equal(t, 1, pcs.Cached)
+	assert.Equal(t, 0, pcs.Uncached)
+
+	pcs, err = GetPcStatus(f.Name(), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, pcs.Sparse)
+	assert.Equal(t, 64, pcs.Pages)
+
+	// the offset of a file of the caller is left as is.
+	f, err = os.Open(f.Name())
+	assert.Nil(t, err)
+	defer f.Close()
+	_, err = f.Seek(int64(psz)+1, io.SeekStart)
+	assert.Nil(t, err)
+	pcs, err = GetPcStatusFromFile(f, nil, Options{SkipHoles: true})
+	assert.Nil(t, err)
+	assert.Equal(t, 63, pcs.Sparse)
+	off, err := f.Seek(0, io.SeekCurrent)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(psz)+1, off)
+}
+
+func TestTrustUnchanged(t *testing.T) {
+	pcs, err := GetPcStatus(os.Args[0], nil)
+	assert.Nil(t, err)
+	assert.False(t, pcs.Skipped)
+
+	prev := pcs
+	prev.Cached = -1
+
+	pcs, err = GetPcStatus(os.Args[0], nil, Options{Previous: &prev})
+	assert.Nil(t, err)
+	assert.False(t, pcs.Skipped)
+
+	pcs, err = GetPcStatus(os.Args[0], nil, Options{Previous: &prev, TrustUnchanged: true})
+	assert.Nil(t, err)
+	assert.True(t, pcs.Skipped)
+	assert.Equal(t, -1, pcs.Cached)
+}
+
+func TestGetPcStatusContextCanceled(t *testing.T) {
+	f, err := ioutil.TempFile("", "pgcacher")
+	assert.Nil(t, err)
+	defer os.Remove(f.Name())
+	_, err = f.Write(make([]byte, 4*os.Getpagesize()))
+	assert.Nil(t, err)
+	f.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = GetPcStatusContext(ctx, f.Name(), nil)
+	assert.Equal(t, context.Canceled, err)
+
+	pcs, err := GetPcStatusContext(context.Background(), f.Name(), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, pcs.Pages)
+}
+
+func TestGetPcStatusFromFile(t *testing.T) {
+	f, err := ioutil.TempFile("", "pgcacher")
+	assert.Nil(t, err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+	_, err = f.Write(make([]byte, 3*os.Getpagesize()))
+	assert.Nil(t, err)
+
+	pcs, err := GetPcStatusFromFile(f, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, f.Name(), pcs.Name)
+	assert.Equal(t, 3, pcs.Pages)
+
+	// the caller still owns the file.
+	_, err = f.Stat()
+	assert.Nil(t, err)
+}
+
+func TestIncludeAllocated(t *testing.T) {
+	f, err := ioutil.TempFile("", "pgcacher")
+	assert.Nil(t, err)
+	defer os.Remove(f.Name())
+	_, err = f.Write(make([]byte, 4*os.Getpagesize()))
+	assert.Nil(t, err)
+	f.Close()
+
+	pcs, err := GetPcStatus(f.Name(), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), pcs.Allocated)
+
+	pcs, err = GetPcStatus(f.Name(), nil, Options{IncludeAllocated: true})
+	assert.Nil(t, err)
+	assert.True(t, pcs.Allocated >= pcs.Size)
+	assert.Equal(t, 0, pcs.CachedBeyondEOF)
+}
+
+func TestDedupHardlinks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pgcacher")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	fname := dir + "/16384"
+	assert.Nil(t, ioutil.WriteFile(fname, make([]byte, 8192), 0644))
+	assert.Nil(t, os.Link(fname, dir+"/16385"))
+
+	var stats []PcStatus
+	for _, name := range []string{fname, dir + "/16385"} {
+		pcs, err := GetPcStatus(name, nil)
+		assert.Nil(t, err)
+		assert.NotEqual(t, uint64(0), pcs.Inode)
+		stats = append(stats, pcs)
+	}
+	assert.Equal(t, stats[0].Inode, stats[1].Inode)
+
+	deduped := Dedup(append(stats, PcStatus{Name: "unscanned"}))
+	assert.Equal(t, 2, len(deduped))
+	assert.Equal(t, fname, deduped[0].Name)
+	assert.Equal(t, "unscanned", deduped[1].Name)
+}
+
+func TestCachedBytes(t *testing.T) {
+	f, err := ioutil.TempFile("", "pgcacher")
+	assert.Nil(t, err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	kpsz := os.Getpagesize()
+	size := int64(4*kpsz + 100)
+	_, err = f.Write(make([]byte, size))
+	assert.Nil(t, err)
+
+	pcs, err := GetPcStatus(f.Name(), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 5, pcs.Cached)
+	assert.Equal(t, size, pcs.CachedBytes)
+
+	// only the full pages are cached.
+	assert.Nil(t, f.Sync())
+	assert.Nil(t, EvictRange(f.Name(), int64(4*kpsz), int64(kpsz)))
+	for _, opt := range []Options{{}, {Bitmap: new(Bitmap)}, {SkipHoles: true}} {
+		pcs, err = GetPcStatus(f.Name(), nil, opt)
+		assert.Nil(t, err)
+		assert.Equal(t, 4, pcs.Cached)
+		assert.Equal(t, int64(4*kpsz), pcs.CachedBytes)
+	}
+}
+
+func TestPagesToBlocks(t *testing.T) {
+	assert.Equal(t, 3, PagesToBlocks(6, 4096, 8192))
+	assert.Equal(t, 1, PagesToBlocks(3, 4096, 8192))
+	assert.Equal(t, 16, PagesToBlocks(2, 65536, 8192))
+	// 16KB blocks of 12KB pages, only the whole blocks are counted.
+	assert.Equal(t, 2, PagesToBlocks(3, 12288, 16384))
+	assert.Equal(t, PagesToBlocks(4, os.Getpagesize(), DefaultBlockSize), PagesToBlocks(4, 0, 0))
+
+	f, err := ioutil.TempFile("", "pgcacher")
+	assert.Nil(t, err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+	_, err = f.Write(make([]byte, 4*DefaultBlockSize))
+	assert.Nil(t, err)
+
+	pcs, err := GetPcStatus(f.Name(), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, pcs.CachedBlocks)
+	pcs, err = GetPcStatus(f.Name(), nil, Options{BlockSize: 2 * DefaultBlockSize})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, pcs.CachedBlocks)
+}
+
+func TestCachedBytesLastPage(t *testing.T) {
+	f, err := ioutil.TempFile("", "pgcacher")
+	assert.Nil(t, err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	kpsz := os.Getpagesize()
+	size := int64(4*kpsz + 100)
+	_, err = f.Write(make([]byte, size))
+	assert.Nil(t, err)
+
+	// only the partial last page is cached.
+	assert.Nil(t, f.Sync())
+	assert.Nil(t, EvictRange(f.Name(), 0, int64(4*kpsz)))
+	pcs, err := GetPcStatus(f.Name(), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, pcs.Cached)
+	assert.Equal(t, int64(100), pcs.CachedBytes)
+}
+
+func TestPcStatusErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pgcacher")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	stats, errs := GetPcStatusBatch([]string{dir, dir + "/16384"}, BatchOptions{})
+	assert.Equal(t, 2, len(stats))
+	assert.True(t, errors.Is(errs[0], ErrIsDirectory))
+	assert.True(t, errors.Is(errs[1], os.ErrNotExist))
+	assert.False(t, errors.Is(errs[1], ErrPermission))
+}
+
+func TestResidencyHash(t *testing.T) {
+	f, err := ioutil.TempFile("", "pgcacher")
+	assert.Nil(t, err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	kpsz := os.Getpagesize()
+	_, err = f.Write(make([]byte, 64*kpsz))
+	assert.Nil(t, err)
+	assert.Nil(t, f.Sync())
+
+	opt := Options{HashResidency: true}
+	first, err := GetPcStatus(f.Name(), nil, opt)
+	assert.Nil(t, err)
+	second, err := GetPcStatus(f.Name(), nil, opt)
+	assert.Nil(t, err)
+	assert.Equal(t, 64, first.Cached)
+	assert.NotEqual(t, "", first.ResidencyHash)
+	assert.Equal(t, first.ResidencyHash, second.ResidencyHash)
+
+	assert.Nil(t, EvictRange(f.Name(), 0, int64(64*kpsz)))
+	evicted, err := GetPcStatus(f.Name(), nil, opt)
+	assert.Nil(t, err)
+	assert.NotEqual(t, first.ResidencyHash, evicted.ResidencyHash)
+
+	plain, err := GetPcStatus(f.Name(), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "", plain.ResidencyHash)
+}
+
+func TestRangeScan(t *testing.T) {
+	f, err := ioutil.TempFile("", "pgcacher")
+	assert.Nil(t, err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	kpsz := os.Getpagesize()
+	_, err = f.Write(make([]byte, 64*kpsz))
+	assert.Nil(t, err)
+	assert.Nil(t, f.Sync())
+
+	// the unaligned offset widens the range to the page it starts in.
+	opt := Options{Offset: int64(4*kpsz + 1), Length: int64(8 * kpsz)}
+	pcs, err := GetPcStatus(f.Name(), nil, opt)
+	assert.Nil(t, err)
+	assert.Equal(t, 9, pcs.Pages)
+	assert.Equal(t, 9, pcs.Cached)
+	assert.Equal(t, int64(64*kpsz), pcs.Size)
+	assert.Equal(t, opt.Offset, pcs.Offset)
+	assert.Equal(t, opt.Length, pcs.Length)
+
+	// the range is clamped to the end of the file.
+	tail, err := GetPcStatus(f.Name(), nil, Options{Offset: int64(60 * kpsz), Length: int64(64 * kpsz)})
+	assert.Nil(t, err)
+	assert.Equal(t, 4, tail.Pages)
+	assert.Equal(t, int64(4*kpsz), tail.Length)
+
+	assert.Nil(t, EvictRange(f.Name(), 0, int64(64*kpsz)))
+	pcs, err = GetPcStatus(f.Name(), nil, opt)
+	assert.Nil(t, err)
+	assert.Equal(t, 9, pcs.Pages)
+	assert.Equal(t, 0, pcs.Cached)
+
+	beyond, err := GetPcStatus(f.Name(), nil, Options{Offset: int64(128 * kpsz)})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, beyond.Pages)
+	assert.Equal(t, int64(0), beyond.Length)
+}
+
+func TestBlockDeviceResidency(t *testing.T) {
+	var dev string
+	for _, name := range []string{"/dev/vda", "/dev/sda", "/dev/nvme0n1", "/dev/loop0"} {
+		if f, err := os.Open(name); err == nil {
+			f.Close()
+			dev = name
+			break
+		}
+	}
+	if dev == "" {
+		t.Skip("no readable block device")
+	}
+
+	plain, err := GetPcStatus(dev, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, plain.Pages)
+
+	pcs, err := GetPcStatus(dev, nil, Options{BlockDeviceResidency: true})
+	assert.Nil(t, err)
+	assert.Equal(t, plain.Size, pcs.Size)
+	assert.Equal(t, int((pcs.Size+int64(os.Getpagesize())-1)/int64(os.Getpagesize())), pcs.Pages)
+	assert.Equal(t, pcs.Pages, pcs.Cached+pcs.Uncached)
+}
+
+func TestChainFilters(t *testing.T) {
+	var calls []string
+	pass := func(name string) func(f *os.File) error {
+		return func(f *os.File) error {
+			calls = append(calls, name)
+			return nil
+		}
+	}
+	errSkip := errors.New("skip")
+	skip := func(f *os.File) error {
+		calls = append(calls, "skip")
+		return errSkip
+	}
+
+	_, err := GetPcStatus(os.Args[0], ChainFilters(pass("a"), nil, skip, pass("b")))
+	assert.Equal(t, errSkip, err)
+	assert.Equal(t, []string{"a", "skip"}, calls)
+
+	calls = nil
+	_, err = GetPcStatus(os.Args[0], ChainFilters(pass("a"), pass("b")))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "b"}, calls)
+}
+
+func TestMaxFileSize(t *testing.T) {
+	f, err := ioutil.TempFile("", "pgcacher")
+	assert.Nil(t, err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	kpsz := os.Getpagesize()
+	_, err = f.Write(make([]byte, 4*kpsz))
+	assert.Nil(t, err)
+
+	pcs, err := GetPcStatus(f.Name(), nil, Options{MaxFileSize: int64(kpsz)})
+	assert.Nil(t, err)
+	assert.True(t, pcs.Skipped)
+	assert.Equal(t, int64(4*kpsz), pcs.Size)
+	assert.Equal(t, 0, pcs.Pages)
+
+	pcs, err = GetPcStatus(f.Name(), nil, Options{MaxFileSize: int64(4 * kpsz)})
+	assert.Nil(t, err)
+	assert.False(t, pcs.Skipped)
+	assert.Equal(t, 4, pcs.Pages)
+}
+
+func TestAge(t *testing.T) {
+	f, err := ioutil.TempFile("", "pgcacher")
+	assert.Nil(t, err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	mtime := time.Now().Add(-30 * 24 * time.Hour)
+	assert.Nil(t, os.Chtimes(f.Name(), mtime, mtime))
+
+	pcs, err := GetPcStatus(f.Name(), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, pcs.Timestamp.Sub(pcs.Mtime), pcs.Age)
+	assert.True(t, pcs.Age >= 30*24*time.Hour)
+}
+
+func TestMountNamespacePID(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("/proc/<pid>/root is linux only")
+	}
+
+	f, err := ioutil.TempFile("", "pgcacher")
+	assert.Nil(t, err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	_, err = f.Write(make([]byte, 2*os.Getpagesize()))
+	assert.Nil(t, err)
+
+	// the root of the process itself is /.
+	pcs, err := GetPcStatus(f.Name(), nil, Options{MountNamespacePID: os.Getpid()})
+	assert.Nil(t, err)
+	assert.Equal(t, f.Name(), pcs.Name)
+	assert.Equal(t, 2, pcs.Pages)
+
+	_, err = GetPcStatus(f.Name(), nil, Options{MountNamespacePID: math.MaxInt32})
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+}
+
+func TestWarmOptions(t *testing.T) {
+	available, err := parseMemAvailable(strings.NewReader("MemTotal:       16314444 kB\nMemAvailable:    8012345 kB\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(8012345*1024), available)
+
+	_, err = parseMemAvailable(strings.NewReader("MemTotal:       16314444 kB\n"))
+	assert.NotNil(t, err)
+
+	if runtime.GOOS != "linux" {
+		return
+	}
+
+	f, err := ioutil.TempFile("", "pgcacher")
+	assert.Nil(t, err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	kpsz := os.Getpagesize()
+	_, err = f.Write(make([]byte, 16*kpsz))
+	assert.Nil(t, err)
+
+	warmed, err := WarmFile(f.Name(), WarmOptions{Budget: int64(4 * kpsz)})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(4*kpsz), warmed)
+
+	_, err = WarmFile(f.Name(), WarmOptions{MinAvailable: math.MaxInt64})
+	assert.Equal(t, ErrMemoryLow, err)
+}
+
+func TestZeroLengthFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pgcacher")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	// a freshly truncated visibility map.
+	fname := filepath.Join(dir, "16384_vm")
+	assert.Nil(t, ioutil.WriteFile(fname, nil, 0600))
+
+	for _, opt := range []Options{
+		{},
+		{PageSize: 8192},
+		{SkipHoles: true},
+		{IncludeDirty: true},
+		{IncludeIdle: true},
+		{IncludeAllocated: true},
+		{HashResidency: true},
+		{Bitmap: new(Bitmap)},
+		{Offset: 8192},
+		{Length: 8192},
+	} {
+		pcs, err := GetPcStatus(fname, nil, opt)
+		assert.Nil(t, err, "%+v", opt)
+		assert.Equal(t, 0, pcs.Pages)
+		assert.Equal(t, 0, pcs.Cached)
+		assert.Equal(t, ForkVM, pcs.Fork)
+	}
+
+	pcs, bitmap, err := GetPcStatusWithBitmap(fname, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, pcs.Pages)
+	assert.Equal(t, 0, len(bitmap))
+
+	f, err := os.Open(fname)
+	assert.Nil(t, err)
+	defer f.Close()
+	pcs, err = GetPcStatusFromFile(f, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, pcs.Pages)
+}
+
+func TestWeightedPercent(t *testing.T) {
+	f, err := ioutil.TempFile("", "pgcacher")
+	assert.Nil(t, err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	kpsz := os.Getpagesize()
+	_, err = f.Write(make([]byte, 8*kpsz))
+	assert.Nil(t, err)
+	assert.Nil(t, f.Sync())
+	assert.Nil(t, EvictRange(f.Name(), 0, int64(8*kpsz)))
+
+	// only the first page, such as the metapage, is cached.
+	warmed, err := WarmRange(f.Name(), 0, int64(kpsz))
+	if err != nil {
+		t.Skip("warming isn't supported")
+	}
+	assert.Equal(t, int64(kpsz), warmed)
+
+	plain, err := GetPcStatus(f.Name(), nil)
+	assert.Nil(t, err)
+	if plain.Cached != 1 {
+		t.Skip("the readahead cached more than the page asked")
+	}
+	assert.Equal(t, plain.Percent, plain.WeightedPercent)
+
+	opt := Options{Weight: func(pageIndex int) float64 {
+		if pageIndex == 0 {
+			return 7
+		}
+		return 1
+	}}
+	pcs, err := GetPcStatus(f.Name(), nil, opt)
+	assert.Nil(t, err)
+	assert.Equal(t, 12.5, pcs.Percent)
+	assert.Equal(t, 50.0, pcs.WeightedPercent)
+}
+
+func TestOpenFileNoAtime(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("O_NOATIME is linux only")
+	}
+
+	f, err := openFile(os.Args[0], true)
+	assert.Nil(t, err)
+	defer f.Close()
+
+	// the flags of the open file description, in octal.
+	fdinfo, err := ioutil.ReadFile(fmt.Sprintf("/proc/self/fdinfo/%d", f.Fd()))
+	assert.Nil(t, err)
+	var flags int
+	for _, line := range strings.Split(string(fdinfo), "\n") {
+		if strings.HasPrefix(line, "flags:") {
+			_, err = fmt.Sscanf(strings.TrimSpace(strings.TrimPrefix(line, "flags:")), "%o", &flags)
+			assert.Nil(t, err)
+		}
+	}
+	assert.NotEqual(t, 0, flags&oNoAtime)
+
+	pcs, err := GetPcStatus(os.Args[0], nil, Options{NoAtime: true})
+	assert.Nil(t, err)
+	assert.Equal(t, os.Args[0], pcs.Name)
+}
+
+func TestIdleCached(t *testing.T) {
+	f, err := ioutil.TempFile("", "pgcacher")
+	assert.Nil(t, err)
+	defer os.Remove(f.Name())
+	_, err = f.Write(make([]byte, 4*os.Getpagesize()))
+	assert.Nil(t, err)
+	f.Close()
+
+	if markErr := MarkIdle(f.Name()); markErr != nil {
+		// without the idle page tracking the count is left 0.
+		pcs, err := GetPcStatus(f.Name(), nil, Options{IncludeIdle: true})
+		assert.Nil(t, err)
+		assert.Equal(t, 0, pcs.IdleCached)
+		t.Skipf("idle page tracking isn't available: %v", markErr)
+	}
+
+	pcs, err := GetPcStatus(f.Name(), nil, Options{IncludeIdle: true})
+	assert.Nil(t, err)
+	assert.True(t, pcs.IdleCached <= pcs.Cached)
+}
+
+func TestIdleCachedRescan(t *testing.T) {
+	f, err := ioutil.TempFile("", "pgcacher")
+	assert.Nil(t, err)
+	defer os.Remove(f.Name())
+	_, err = f.Write(make([]byte, 4*os.Getpagesize()))
+	assert.Nil(t, err)
+	assert.Nil(t, f.Sync())
+	f.Close()
+
+	if err := MarkIdle(f.Name()); err != nil {
+		t.Skipf("idle page tracking isn't available: %v", err)
+	}
+
+	// the scan itself must not take the pages out of idle.
+	first, err := GetPcStatus(f.Name(), nil, Options{IncludeIdle: true})
+	assert.Nil(t, err)
+	if first.IdleCached == 0 {
+		t.Skip("the pfns of the pages aren't readable")
+	}
+	second, err := GetPcStatus(f.Name(), nil, Options{IncludeIdle: true})
+	assert.Nil(t, err)
+	assert.Equal(t, first.IdleCached, second.IdleCached)
+}
+
+func TestPhysicalPercent(t *testing.T) {
+	f, err := ioutil.TempFile("", "pgcacher")
+	assert.Nil(t, err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	// a sparse file stands in for a compressed one, the physical size is
+	// a page of the logical 16.
+	kpsz := os.Getpagesize()
+	_, err = f.Write(make([]byte, kpsz))
+	assert.Nil(t, err)
+	assert.Nil(t, f.Truncate(int64(16*kpsz)))
+
+	pcs, err := GetPcStatus(f.Name(), nil, Options{IncludeAllocated: true})
+	assert.Nil(t, err)
+	if pcs.Allocated == 0 || pcs.Allocated >= pcs.Size {
+		t.Skip("the filesystem of the temp dir has no sparse files")
+	}
+	assert.Equal(t, 100.0/16, pcs.Percent)
+
+	pcs, err = GetPcStatus(f.Name(), nil, Options{PhysicalPercent: true})
+	assert.Nil(t, err)
+	assert.NotEqual(t, int64(0), pcs.Allocated)
+	assert.Equal(t, physicalPercent(int64(kpsz), pcs.Allocated), pcs.Percent)
+	assert.Equal(t, 100.0, physicalPercent(2*int64(kpsz), int64(kpsz)))
+}
+
+func TestStopIfCold(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("eviction is linux only")
+	}
+
+	f, err := ioutil.TempFile("", "pgcacher")
+	assert.Nil(t, err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+	size := 4 * sampleWindow
+	_, err = f.Write(make([]byte, size))
+	assert.Nil(t, err)
+	assert.Nil(t, f.Sync())
+
+	// the PageSize of postgresql skips the exact cachestat.
+	opt := Options{PageSize: 8192, StopIfCold: 2}
+	pcs, err := GetPcStatus(f.Name(), nil, opt)
+	assert.Nil(t, err)
+	assert.False(t, pcs.Approximate)
+	assert.Equal(t, int(size/8192), pcs.Cached)
+
+	assert.Nil(t, EvictFile(f.Name()))
+	pcs, err = GetPcStatus(f.Name(), nil, opt)
+	assert.Nil(t, err)
+	assert.True(t, pcs.Approximate)
+	assert.Equal(t, 0, pcs.Cached)
+	assert.Equal(t, int(size/8192), pcs.Pages)
+}
+
+func TestCheckTruncated(t *testing.T) {
+	f, err := ioutil.TempFile("", "pgcacher")
+	assert.Nil(t, err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	kpsz := os.Getpagesize()
+	_, err = f.Write(make([]byte, 8*kpsz))
+	assert.Nil(t, err)
+	assert.Nil(t, f.Sync())
+
+	// the status of the stat and the mincore before the truncate, every
+	// other page cached.
+	bitmap := make([]bool, 8)
+	for idx := range bitmap {
+		bitmap[idx] = idx%2 == 0
+	}
+	pcs := PcStatus{Size: int64(8 * kpsz), Pages: 8, Cached: 4}
+
+	assert.Nil(t, f.Truncate(int64(3*kpsz+1)))
+	assert.Nil(t, checkTruncated(f, f.Name(), &pcs, bitmap, kpsz))
+	assert.True(t, pcs.Truncated)
+	assert.Equal(t, int64(3*kpsz+1), pcs.Size)
+	assert.Equal(t, 4, pcs.Pages)
+	assert.Equal(t, 2, pcs.Cached)
+
+	// no bitmap, the cached pages are clamped to the pages left.
+	pcs = PcStatus{Size: int64(3*kpsz + 1), Pages: 4, Cached: 4}
+	assert.Nil(t, f.Truncate(int64(kpsz)))
+	assert.Nil(t, checkTruncated(f, f.Name(), &pcs, nil, kpsz))
+	assert.True(t, pcs.Truncated)
+	assert.Equal(t, 1, pcs.Pages)
+	assert.Equal(t, 1, pcs.Cached)
+
+	// the file is removed, such as by DROP TABLE, the open fd still works.
+	pcs = PcStatus{Size: int64(kpsz), Pages: 1, Cached: 1}
+	assert.Nil(t, os.Remove(f.Name()))
+	err = checkTruncated(f, f.Name(), &pcs, nil, kpsz)
+	assert.True(t, errors.Is(err, ErrFileVanished))
+	assert.False(t, pcs.Truncated)
+
+	// the fd has no name to check, it's never vanished.
+	assert.Nil(t, checkVanished("", nil))
+}
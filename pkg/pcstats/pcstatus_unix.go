@@ -0,0 +1,25 @@
+//go:build dragonfly || netbsd || openbsd || solaris
+// +build dragonfly netbsd openbsd solaris
+
+package pcstats
+
+import (
+	"errors"
+	"os"
+)
+
+// the values of solaris, lseek fails with EINVAL on the platforms without
+// them, then no holes are counted.
+const (
+	seekData = 3
+	seekHole = 4
+
+	mincoreIncore = 0x1
+
+	// no O_NOATIME
+	oNoAtime = 0
+)
+
+func getBlockDeviceSize(f *os.File) (int64, error) {
+	return 0, errors.New("block device size is not supported on this platform")
+}
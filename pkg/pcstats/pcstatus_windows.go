@@ -0,0 +1,56 @@
+package pcstats
+
+import (
+	"context"
+	"net"
+	"os"
+)
+
+// there is no mincore on windows, all the scans return ErrUnsupportedPlatform,
+// the stubs only keep the package building.
+const platformSupported = false
+
+const (
+	seekData = 3
+	seekHole = 4
+
+	mincoreIncore = 0x1
+
+	oNoAtime = 0
+)
+
+func getBlockDeviceSize(f *os.File) (int64, error) {
+	return 0, ErrUnsupportedPlatform
+}
+
+func forEachMincoreWindow(ctx context.Context, f *os.File, size, window int64, fn func(off, length int64, vec []byte) error) error {
+	return ErrUnsupportedPlatform
+}
+
+func getMincoreRange(ctx context.Context, f *os.File, off, length int64) ([]byte, error) {
+	return nil, ErrUnsupportedPlatform
+}
+
+func allocatedSize(finfo os.FileInfo) int64 {
+	return 0
+}
+
+func kernelRelease() string {
+	return ""
+}
+
+func fileID(finfo os.FileInfo) (uint64, uint64) {
+	return 0, 0
+}
+
+func SendFile(conn *net.UnixConn, f *os.File, name string) error {
+	return ErrUnsupportedPlatform
+}
+
+func ReceiveFile(conn *net.UnixConn) (*os.File, string, error) {
+	return nil, "", ErrUnsupportedPlatform
+}
+
+func ReceivePcStatus(conn *net.UnixConn, filter func(f *os.File) error, opts ...Options) (PcStatus, error) {
+	return PcStatus{}, ErrUnsupportedPlatform
+}
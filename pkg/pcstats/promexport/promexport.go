@@ -0,0 +1,136 @@
+// promexport exports the page cache status of files as prometheus metrics.
+package promexport
+
+import (
+	"net/http"
+	"path"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/rfyiamcool/pgcacher/pkg/pcstats"
+)
+
+var labelNames = []string{"file", "relation", "database", "table"}
+
+var (
+	pagesCachedDesc = prometheus.NewDesc(
+		"pgcacher_pages_cached",
+		"Number of pages of the file in the page cache.",
+		labelNames, nil,
+	)
+	pagesTotalDesc = prometheus.NewDesc(
+		"pgcacher_pages_total",
+		"Number of pages of the file.",
+		labelNames, nil,
+	)
+	percentCachedDesc = prometheus.NewDesc(
+		"pgcacher_percent_cached",
+		"Percentage of pages of the file in the page cache.",
+		labelNames, nil,
+	)
+	sizeBytesDesc = prometheus.NewDesc(
+		"pgcacher_size_bytes",
+		"Size of the file in bytes.",
+		labelNames, nil,
+	)
+)
+
+// Resolver maps a file to the database and table it belongs to, return
+// empty strings when it's unknown.
+type Resolver func(file string) (database, table string)
+
+// sample is the metrics of a file of the latest scan.
+type sample struct {
+	labels  []string
+	cached  float64
+	pages   float64
+	percent float64
+	size    float64
+}
+
+// Exporter is a prometheus.Collector of the page cache status of the files
+// of the latest Update.
+type Exporter struct {
+	resolver Resolver
+
+	// mu guards samples, which Update swaps as a whole, so a scrape sees
+	// either the previous scan or the latest one, never a mix of them.
+	mu      sync.RWMutex
+	samples []sample
+}
+
+// New creates the exporter and registers it with reg, resolver may be nil.
+func New(reg prometheus.Registerer, resolver Resolver) (*Exporter, error) {
+	e := &Exporter{resolver: resolver}
+	if err := reg.Register(e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Describe implements prometheus.Collector.
+func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
+	ch <- pagesCachedDesc
+	ch <- pagesTotalDesc
+	ch <- percentCachedDesc
+	ch <- sizeBytesDesc
+}
+
+// Collect implements prometheus.Collector, it emits the samples of the
+// latest Update.
+func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
+	e.mu.RLock()
+	samples := e.samples
+	e.mu.RUnlock()
+
+	for _, s := range samples {
+		ch <- prometheus.MustNewConstMetric(pagesCachedDesc, prometheus.GaugeValue, s.cached, s.labels...)
+		ch <- prometheus.MustNewConstMetric(pagesTotalDesc, prometheus.GaugeValue, s.pages, s.labels...)
+		ch <- prometheus.MustNewConstMetric(percentCachedDesc, prometheus.GaugeValue, s.percent, s.labels...)
+		ch <- prometheus.MustNewConstMetric(sizeBytesDesc, prometheus.GaugeValue, s.size, s.labels...)
+	}
+}
+
+// Update replaces the metrics with the statuses of the latest scan, so the
+// removed files don't linger. a file listed twice keeps its last status.
+func (e *Exporter) Update(statuses []pcstats.PcStatus) {
+	var (
+		samples = make([]sample, 0, len(statuses))
+		seen    = make(map[string]int, len(statuses))
+	)
+	for _, pcs := range statuses {
+		s := sample{
+			labels:  e.labels(pcs.Name),
+			cached:  float64(pcs.Cached),
+			pages:   float64(pcs.Pages),
+			percent: pcs.Percent,
+			size:    float64(pcs.Size),
+		}
+		if idx, ok := seen[pcs.Name]; ok {
+			samples[idx] = s
+			continue
+		}
+		seen[pcs.Name] = len(samples)
+		samples = append(samples, s)
+	}
+
+	e.mu.Lock()
+	e.samples = samples
+	e.mu.Unlock()
+}
+
+// labels returns the values of labelNames of the file.
+func (e *Exporter) labels(file string) []string {
+	var database, table string
+	if e.resolver != nil {
+		database, table = e.resolver(file)
+	}
+	return []string{file, path.Base(pcstats.TrimSegmentSuffix(file)), database, table}
+}
+
+// Handler returns the http.Handler serving the metrics of g.
+func Handler(g prometheus.Gatherer) http.Handler {
+	return promhttp.HandlerFor(g, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,87 @@
+package promexport
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/rfyiamcool/pgcacher/pkg/pcstats"
+)
+
+func TestExporter(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	resolver := func(file string) (string, string) {
+		if strings.HasPrefix(file, "/pgdata/base/5/") {
+			return "postgres", "public.orders"
+		}
+		return "", ""
+	}
+	e, err := New(reg, resolver)
+	assert.Nil(t, err)
+
+	e.Update([]pcstats.PcStatus{
+		{Name: "/pgdata/base/5/16384.1", Size: 16384, Pages: 4, Cached: 1, Percent: 25},
+		{Name: "/tmp/other", Size: 4096, Pages: 1, Cached: 1, Percent: 100},
+	})
+	expected := `
+# HELP pgcacher_pages_cached Number of pages of the file in the page cache.
+# TYPE pgcacher_pages_cached gauge
+pgcacher_pages_cached{database="postgres",file="/pgdata/base/5/16384.1",relation="16384",table="public.orders"} 1
+pgcacher_pages_cached{database="",file="/tmp/other",relation="other",table=""} 1
+# HELP pgcacher_pages_total Number of pages of the file.
+# TYPE pgcacher_pages_total gauge
+pgcacher_pages_total{database="postgres",file="/pgdata/base/5/16384.1",relation="16384",table="public.orders"} 4
+pgcacher_pages_total{database="",file="/tmp/other",relation="other",table=""} 1
+# HELP pgcacher_percent_cached Percentage of pages of the file in the page cache.
+# TYPE pgcacher_percent_cached gauge
+pgcacher_percent_cached{database="postgres",file="/pgdata/base/5/16384.1",relation="16384",table="public.orders"} 25
+pgcacher_percent_cached{database="",file="/tmp/other",relation="other",table=""} 100
+# HELP pgcacher_size_bytes Size of the file in bytes.
+# TYPE pgcacher_size_bytes gauge
+pgcacher_size_bytes{database="postgres",file="/pgdata/base/5/16384.1",relation="16384",table="public.orders"} 16384
+pgcacher_size_bytes{database="",file="/tmp/other",relation="other",table=""} 4096
+`
+	assert.Nil(t, testutil.CollectAndCompare(e, strings.NewReader(expected)))
+
+	// the files of the previous scan don't linger, a duplicate keeps the last.
+	e.Update([]pcstats.PcStatus{
+		{Name: "/tmp/other", Size: 4096, Pages: 1, Cached: 1, Percent: 100},
+		{Name: "/tmp/other", Size: 4096, Pages: 1, Cached: 0, Percent: 0},
+	})
+	expected = `
+# HELP pgcacher_pages_cached Number of pages of the file in the page cache.
+# TYPE pgcacher_pages_cached gauge
+pgcacher_pages_cached{database="",file="/tmp/other",relation="other",table=""} 0
+`
+	assert.Nil(t, testutil.CollectAndCompare(e, strings.NewReader(expected), "pgcacher_pages_cached"))
+}
+
+func TestExporterConcurrentScrape(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	e, err := New(reg, nil)
+	assert.Nil(t, err)
+
+	statuses := make([]pcstats.PcStatus, 100)
+	for idx := range statuses {
+		statuses[idx] = pcstats.PcStatus{Name: "/tmp/" + strings.Repeat("x", idx+1), Pages: 1}
+	}
+	e.Update(statuses)
+
+	// every scrape sees a whole scan while the updates keep swapping it.
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			e.Update(statuses)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		assert.Equal(t, 4*len(statuses), testutil.CollectAndCount(e))
+	}
+	wg.Wait()
+}
@@ -0,0 +1,23 @@
+//go:build linux && (386 || arm || mips || mipsle)
+// +build linux
+// +build 386 arm mips mipsle
+
+package pcstats
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// readahead is readahead(2) by posix_fadvise(POSIX_FADV_WILLNEED) on the 32
+// bits arches, whose off64_t is split across the registers by the arch,
+// which unix.Fadvise takes care of. the kernel reads the range in the same
+// way.
+func readahead(f *os.File, off, count int64) error {
+	if err := unix.Fadvise(int(f.Fd()), off, count, unix.FADV_WILLNEED); err != nil {
+		return fmt.Errorf("could not fadvise WILLNEED: %v", err)
+	}
+	return nil
+}
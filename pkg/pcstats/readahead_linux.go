@@ -0,0 +1,23 @@
+//go:build linux && !386 && !arm && !mips && !mipsle
+// +build linux,!386,!arm,!mips,!mipsle
+
+package pcstats
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// readahead asks the kernel to read count bytes of the file from off into
+// the page cache, without waiting for the io.
+func readahead(f *os.File, off, count int64) error {
+	// readahead(2): ssize_t readahead(int fd, off64_t offset, size_t count);
+	// the off64_t fits a single register on the 64 bits arches only.
+	_, _, errno := unix.Syscall(unix.SYS_READAHEAD, f.Fd(), uintptr(off), uintptr(count))
+	if errno != 0 {
+		return fmt.Errorf("syscall SYS_READAHEAD failed: %v", errno)
+	}
+	return nil
+}
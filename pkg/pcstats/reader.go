@@ -0,0 +1,62 @@
+package pcstats
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// GetPcStatusFromReader gets the page cache status of the files listed in r,
+// one path per line, such as the output of find. the errors are prefixed
+// with the line number of the file, a failure to read r is returned as the
+// last entry.
+func GetPcStatusFromReader(r io.Reader, opts BatchOptions) ([]PcStatus, []error) {
+	fnames, lines, rerr := readFileList(r)
+
+	stats, errs := GetPcStatusBatch(fnames, opts)
+	for idx, err := range errs {
+		if err != nil {
+			errs[idx] = fmt.Errorf("line %d: %w", lines[idx], err)
+		}
+	}
+
+	if rerr != nil {
+		stats = append(stats, PcStatus{})
+		errs = append(errs, rerr)
+	}
+	return stats, errs
+}
+
+// ReadFileList reads the paths from r, one per line, the whitespaces are
+// trimmed, the blank lines and the lines starting with `#` are skipped.
+func ReadFileList(r io.Reader) ([]string, error) {
+	fnames, _, err := readFileList(r)
+	return fnames, err
+}
+
+// readFileList returns the paths and their line numbers.
+func readFileList(r io.Reader) ([]string, []int, error) {
+	var (
+		fnames []string
+		lines  []int
+		lineno int
+	)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		lineno++
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fnames = append(fnames, line)
+		lines = append(lines, lineno)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fnames, lines, fmt.Errorf("reading file list failed: %v", err)
+	}
+	return fnames, lines, nil
+}
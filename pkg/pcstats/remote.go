@@ -0,0 +1,123 @@
+package pcstats
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+)
+
+// agentRequest is a line of JSON sent by RemoteScan to the agent.
+type agentRequest struct {
+	Files   []string `json:"files"`
+	Options Options  `json:"options"`
+}
+
+// agentResponse is a line of JSON sent back by ServeAgent, Errors[i] is the
+// error of Files[i] of the request or "".
+type agentResponse struct {
+	Statuses []PcStatus `json:"statuses"`
+	Errors   []string   `json:"errors"`
+}
+
+// RemoteScan gets the page cache status of the files on a remote host, by
+// sending them to the agent, ServeAgent or `pgcacher -agent`, at the other
+// end of conn and decoding its results. any transport works, such as an ssh
+// session or CommandTransport running `ssh host pgcacher -agent`. the results
+// are in the order of fnames as GetPcStatusBatch, the files which failed on
+// the remote have Error set to the remote error, so they can be told apart
+// from the uncached files. conn is closed when done.
+func RemoteScan(conn io.ReadWriteCloser, fnames []string, opts ...Options) ([]PcStatus, error) {
+	defer conn.Close()
+
+	req, err := json.Marshal(agentRequest{Files: fnames, Options: getOptions(opts)})
+	if err != nil {
+		return nil, fmt.Errorf("could not encode the request: %v", err)
+	}
+	if _, err := conn.Write(append(req, '\n')); err != nil {
+		return nil, fmt.Errorf("could not send the request: %v", err)
+	}
+
+	var resp agentResponse
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("could not decode the response: %v", err)
+	}
+	if len(resp.Errors) != len(resp.Statuses) {
+		return nil, errors.New("malformed response of the agent")
+	}
+
+	for idx, msg := range resp.Errors {
+		if msg != "" {
+			resp.Statuses[idx].Error = msg
+		}
+	}
+	return resp.Statuses, nil
+}
+
+// ServeAgent answers the requests of RemoteScan read from r, one line of
+// JSON per request, and writes the responses to w, until r is closed.
+func ServeAgent(r io.Reader, w io.Writer, concurrency int) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+
+	enc := json.NewEncoder(w)
+	for scanner.Scan() {
+		var req agentRequest
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			return fmt.Errorf("could not decode the request: %v", err)
+		}
+
+		stats, errs := GetPcStatusBatch(req.Files, BatchOptions{Concurrency: concurrency, Options: req.Options})
+		resp := agentResponse{Statuses: stats, Errors: make([]string, len(errs))}
+		for idx, err := range errs {
+			if err != nil {
+				resp.Errors[idx] = err.Error()
+			}
+		}
+
+		if err := enc.Encode(resp); err != nil {
+			return fmt.Errorf("could not send the response: %v", err)
+		}
+	}
+	return scanner.Err()
+}
+
+// CommandTransport starts cmd and returns its stdin and stdout as the conn
+// of RemoteScan, such as exec.Command("ssh", "db1", "pgcacher", "-agent").
+// closing it closes the stdin and waits for cmd to exit.
+func CommandTransport(cmd *exec.Cmd) (io.ReadWriteCloser, error) {
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("could not get the stdin of the command: %v", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("could not get the stdout of the command: %v", err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("could not start the command: %v", err)
+	}
+	return &commandConn{cmd: cmd, stdin: stdin, stdout: stdout}, nil
+}
+
+type commandConn struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout io.Reader
+}
+
+func (c *commandConn) Read(p []byte) (int, error) {
+	return c.stdout.Read(p)
+}
+
+func (c *commandConn) Write(p []byte) (int, error) {
+	return c.stdin.Write(p)
+}
+
+func (c *commandConn) Close() error {
+	c.stdin.Close()
+	return c.cmd.Wait()
+}
@@ -0,0 +1,76 @@
+package pcstats
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRemoteScan(t *testing.T) {
+	f, err := ioutil.TempFile("", "pgcacher")
+	assert.Nil(t, err)
+	defer os.Remove(f.Name())
+	_, err = f.Write(make([]byte, 2*os.Getpagesize()))
+	assert.Nil(t, err)
+	f.Close()
+
+	client, agent := net.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- ServeAgent(agent, agent, 2)
+		agent.Close()
+	}()
+
+	stats, err := RemoteScan(client, []string{f.Name(), "/nonexistent/16384"})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(stats))
+	assert.Equal(t, f.Name(), stats[0].Name)
+	assert.Equal(t, 2, stats[0].Pages)
+	assert.Equal(t, "", stats[0].Error)
+	assert.Equal(t, "/nonexistent/16384", stats[1].Name)
+	assert.NotEqual(t, "", stats[1].Error)
+
+	// the agent stops once the conn is closed by RemoteScan.
+	assert.Nil(t, <-done)
+}
+
+func TestFanOutScan(t *testing.T) {
+	f, err := ioutil.TempFile("", "pgcacher")
+	assert.Nil(t, err)
+	defer os.Remove(f.Name())
+	_, err = f.Write(make([]byte, 2*os.Getpagesize()))
+	assert.Nil(t, err)
+	f.Close()
+
+	dial := func(host string) (io.ReadWriteCloser, error) {
+		if host == "down" {
+			return nil, errors.New("connection refused")
+		}
+		client, agent := net.Pipe()
+		go func() {
+			ServeAgent(agent, agent, 1)
+			agent.Close()
+		}()
+		return client, nil
+	}
+
+	results := FanOutScan([]string{"replica", "primary", "down"}, dial, []string{f.Name(), "/nonexistent/16384"})
+	assert.Equal(t, 3, len(results))
+	assert.NotNil(t, results["down"].Err)
+	assert.Nil(t, results["primary"].Err)
+	assert.Equal(t, 2, len(results["replica"].Statuses))
+
+	m := MergeHostResults(results)
+	assert.Equal(t, []string{"primary", "replica"}, m.Hosts)
+	assert.Equal(t, []string{"/nonexistent/16384", f.Name()}, m.Names)
+	assert.Equal(t, 2, len(m.Percent[f.Name()]))
+	assert.Equal(t, 0, len(m.Errors[f.Name()]))
+	// the failed file is an error on both hosts rather than 0% cached.
+	assert.Equal(t, 0, len(m.Percent["/nonexistent/16384"]))
+	assert.Equal(t, 2, len(m.Errors["/nonexistent/16384"]))
+}
@@ -0,0 +1,69 @@
+package pcstats
+
+import "os"
+
+// CacheRuns returns the histograms of the contiguous cached and uncached runs
+// in the bitmap from GetPcStatusWithBitmap, cachedRuns[n] is the number of
+// cached runs that are n pages long. a hot contiguous half of a table gives
+// one long run, a checkerboarded one gives a lot of runs of length 1.
+func CacheRuns(bitmap []bool) (cachedRuns, uncachedRuns []int) {
+	for start := 0; start < len(bitmap); {
+		end := start + 1
+		for end < len(bitmap) && bitmap[end] == bitmap[start] {
+			end++
+		}
+
+		if bitmap[start] {
+			cachedRuns = addRun(cachedRuns, end-start)
+		} else {
+			uncachedRuns = addRun(uncachedRuns, end-start)
+		}
+		start = end
+	}
+	return cachedRuns, uncachedRuns
+}
+
+func addRun(hist []int, length int) []int {
+	if length >= len(hist) {
+		grown := make([]int, length+1)
+		copy(grown, hist)
+		hist = grown
+	}
+	hist[length]++
+	return hist
+}
+
+// ByteRange is the bytes [Offset, Offset+Length) of a file.
+type ByteRange struct {
+	Offset int64 `json:"offset"`
+	Length int64 `json:"length"`
+}
+
+// UncachedRanges returns the ranges of the consecutive uncached pages of the
+// file, coalesced, in order, such as to WarmRange them for a relation to be
+// cached in full. the last range ends at size rather than at the end of its
+// page.
+func UncachedRanges(f *os.File, size int64) ([]ByteRange, error) {
+	var (
+		ranges []ByteRange
+		psz    = int64(os.Getpagesize())
+	)
+	err := ForEachPage(f, size, func(pageIndex int, cached bool) error {
+		if cached {
+			return nil
+		}
+
+		off := int64(pageIndex) * psz
+		length := min64(psz, size-off)
+		if n := len(ranges); n != 0 && ranges[n-1].Offset+ranges[n-1].Length == off {
+			ranges[n-1].Length += length
+			return nil
+		}
+		ranges = append(ranges, ByteRange{Offset: off, Length: length})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ranges, nil
+}
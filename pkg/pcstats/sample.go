@@ -0,0 +1,74 @@
+package pcstats
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"os"
+)
+
+// sampleWindow is the size of a window mincored by the sampling, small
+// enough that the samples spread over a 1GB segment.
+var sampleWindow int64 = 1024 * 1024
+
+// GetFileMincoreSampled is GetFileMincore of only 1 of every `every` windows
+// of 1MB, the window of each group of `every` is picked randomly by the seed,
+// so the same seed samples the same windows. Cached is extrapolated from the
+// windows sampled and Cached+Miss is the exact number of pages. an every < 2
+// mincores the whole file.
+func GetFileMincoreSampled(f *os.File, size int64, every int, seed int64) (*Mincore, error) {
+	mincore, _, err := getSampledMincore(context.Background(), f, size, os.Getpagesize(), every, seed)
+	return mincore, err
+}
+
+// getSampledMincore counts the pages of pageSize of the sampled windows and
+// extrapolates them to the whole file. the error of the estimate shrinks with
+// the square root of the windows sampled, but the residency of postgresql
+// files is clustered, such as the hot tail of a table being appended to, so
+// a sample may well miss a small hot region. it returns whether the counts
+// are extrapolated, a file of one window is always counted exactly.
+func getSampledMincore(ctx context.Context, f *os.File, size int64, pageSize int, every int, seed int64) (*Mincore, bool, error) {
+	if every < 2 || size <= sampleWindow {
+		mincore, err := getFileMincore(ctx, f, size, pageSize, nil)
+		return mincore, false, err
+	}
+
+	// the window is a multiple of both pageSize and the kernel page size.
+	window := sampleWindow
+	if align := int64(pageSize); window%align != 0 {
+		window = (window/align + 1) * align
+	}
+
+	var (
+		rng     = rand.New(rand.NewSource(seed))
+		windows = (size + window - 1) / window
+		cached  int64
+		sampled int64
+	)
+	for group := int64(0); group < windows; group += int64(every) {
+		if err := ctx.Err(); err != nil {
+			return nil, false, err
+		}
+
+		off := (group + rng.Int63n(min64(int64(every), windows-group))) * window
+		length := min64(window, size-off)
+		vec, err := getMincoreRange(ctx, f, off, length)
+		if err != nil {
+			return nil, false, err
+		}
+		if pageSize != os.Getpagesize() {
+			vec = regroupMincoreVec(vec, length, pageSize)
+		}
+
+		for _, b := range vec {
+			if isResident(b) {
+				cached++
+			}
+		}
+		sampled += int64(len(vec))
+	}
+
+	pages := (size + int64(pageSize) - 1) / int64(pageSize)
+	estimate := int64(math.Round(float64(cached) * float64(pages) / float64(sampled)))
+	return &Mincore{Cached: estimate, Miss: pages - estimate}, sampled < pages, nil
+}
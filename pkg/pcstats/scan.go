@@ -0,0 +1,247 @@
+package pcstats
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ScanOptions controls how ScanDir walks the directory tree.
+type ScanOptions struct {
+	// MaxDepth bounds the depth of dirs to walk, 1 only scans the files
+	// right under root, 0 means no limit.
+	MaxDepth int
+
+	// FollowSymlinks walks into the symlinked dirs, such as the tablespaces
+	// of pg_tblspc, they are skipped by default. every dir is walked once by
+	// its real path, so the symlink loops are safe either way.
+	FollowSymlinks bool
+
+	// Include and Exclude are the glob patterns of filepath.Match, the
+	// patterns with a `/` match the path relative to root, the others match
+	// the base name. a file is scanned if it matches any of Include, or
+	// Include is empty, and none of Exclude, Exclude wins on conflicts.
+	Include []string
+	Exclude []string
+
+	// ExcludeRegex excludes the files whose full path matches it, such as
+	// `_(fsm|vm)(\.[0-9]+)?$`, it may be nil.
+	ExcludeRegex *regexp.Regexp
+
+	// ModifiedSince and ModifiedBefore only scan the files whose mtime is in
+	// [ModifiedSince, ModifiedBefore), such as the relations written in the
+	// last minutes, by the stat of the walk before any mapping. the zero
+	// times mean no bound.
+	ModifiedSince  time.Time
+	ModifiedBefore time.Time
+
+	// CollapseSegments merges the segments of every relation fork, such as
+	// 16384, 16384.1 and 16384.2, into one status by SumPcStatus, named by
+	// the base relfilenode. the forks stay apart, 16384_fsm is another row,
+	// so are the files with errors and the files which aren't relations.
+	// the percent filter of Batch applies to the merged rows.
+	CollapseSegments bool
+
+	// LabelKinds sets PcStatus.Kind of every file by FileKind, such as to
+	// sum the cache used by the wal segments of pg_wal apart from the
+	// relations.
+	LabelKinds bool
+
+	// Batch controls how the files found are scanned.
+	Batch BatchOptions
+}
+
+// ScanDir walks the directory tree of root and gets the page cache status of
+// every regular file, the special files such as sockets and pipes are
+// skipped. errs[i] is the error of stats[i] or nil, the dirs which can't be
+// read and the symlinks which can't be stat'ed are in the results with their
+// errors, the walk goes on. the files are in lexical order followed by those
+// errors, or all sorted by name with Batch.SortByName. with CollapseSegments a relation is at the
+// place of its first segment.
+func ScanDir(root string, opts ScanOptions) ([]PcStatus, []error) {
+	fnames, walkErrs := WalkFiles(root, opts)
+
+	batch := opts.Batch
+	if opts.CollapseSegments {
+		batch.MinPercent, batch.MaxPercent = 0, 0
+	}
+
+	stats, errs := GetPcStatusBatch(fnames, batch)
+	if opts.CollapseSegments {
+		stats, errs = collapseSegments(stats, errs)
+		if opts.Batch.hasPercentFilter() {
+			stats, errs = filterPercent(stats, errs, opts.Batch)
+		}
+	}
+	if opts.LabelKinds {
+		for idx := range stats {
+			stats[idx].Kind = FileKind(stats[idx].Name)
+		}
+	}
+	for _, err := range walkErrs {
+		if opts.Batch.SkipPermissionDenied && errors.Is(err, ErrPermission) {
+			stats = append(stats, PcStatus{Name: err.Path, Skipped: true, SkipReason: SkipPermission})
+			errs = append(errs, nil)
+			continue
+		}
+		stats = append(stats, PcStatus{Name: err.Path, Error: err.Error()})
+		errs = append(errs, err)
+	}
+	if opts.Batch.SortByName {
+		sortByName(stats, errs)
+	}
+	return stats, errs
+}
+
+// WalkFiles returns the regular files of the directory tree of root that
+// ScanDir would scan, in lexical order, and the errors of the dirs which
+// can't be read and of the symlinks which can't be stat'ed.
+func WalkFiles(root string, opts ScanOptions) ([]string, []*os.PathError) {
+	w := walkTree(root, opts)
+	return w.files, w.errs
+}
+
+// walkTree walks the directory tree of root, the walker holds the results.
+func walkTree(root string, opts ScanOptions) *walker {
+	w := &walker{
+		root:    root,
+		opts:    opts,
+		visited: make(map[string]bool),
+	}
+	w.walk(root, 1)
+	return w
+}
+
+// EstimateScan walks the directory tree of root as ScanDir and returns the
+// number of files and the bytes it would map, without any mincore, so the
+// cost of a huge scan can be known before it. the files over
+// Batch.Options.MaxFileSize aren't counted. the sizes are the ones the walk
+// already read, so no file is stat'ed twice. err is the first error of
+// WalkFiles, the walk goes on, so the counts are still returned.
+func EstimateScan(root string, opts ScanOptions) (files int, totalBytes int64, err error) {
+	w := walkTree(root, opts)
+	if len(w.errs) != 0 {
+		err = w.errs[0]
+	}
+
+	for _, size := range w.sizes {
+		if opts.Batch.Options.tooLarge(size) {
+			continue
+		}
+		files++
+		totalBytes += size
+	}
+	return files, totalBytes, err
+}
+
+type walker struct {
+	root    string
+	opts    ScanOptions
+	visited map[string]bool
+
+	files []string
+	sizes []int64 // the sizes of files, by the stat of the walk
+	errs  []*os.PathError
+}
+
+func (w *walker) walk(dir string, depth int) {
+	logger := w.opts.Batch.logger()
+
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		logger.Warn("could not walk %q: %v", dir, err)
+		w.errs = append(w.errs, &os.PathError{Op: "walk", Path: dir, Err: err})
+		return
+	}
+	if w.visited[realDir] {
+		return
+	}
+	w.visited[realDir] = true
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		logger.Warn("could not walk %q: %v", dir, err)
+		w.errs = append(w.errs, &os.PathError{Op: "walk", Path: dir, Err: err})
+		return
+	}
+
+	for _, entry := range entries {
+		fname := filepath.Join(dir, entry.Name())
+
+		info, mode := entry, entry.Mode()
+		if mode&os.ModeSymlink != 0 {
+			finfo, err := os.Stat(fname)
+			if os.IsNotExist(err) {
+				logger.Debug("skipped the dangling symlink %q", fname)
+				continue
+			}
+			if err != nil {
+				logger.Warn("could not stat %q: %v", fname, err)
+				w.errs = append(w.errs, &os.PathError{Op: "stat", Path: fname, Err: err})
+				continue
+			}
+			if finfo.IsDir() && !w.opts.FollowSymlinks {
+				continue
+			}
+			info, mode = finfo, finfo.Mode()
+		}
+
+		switch {
+		case mode.IsDir():
+			if w.opts.MaxDepth == 0 || depth < w.opts.MaxDepth {
+				w.walk(fname, depth+1)
+			}
+		case mode.IsRegular():
+			if !w.opts.modifiedIn(info.ModTime()) {
+				logger.Debug("skipped %q out of the mtime window, mtime: %v", fname, info.ModTime())
+				continue
+			}
+			if w.match(fname) {
+				w.files = append(w.files, fname)
+				w.sizes = append(w.sizes, info.Size())
+			}
+		default:
+			logger.Debug("skipped the special file %q, mode: %v", fname, mode)
+		}
+	}
+}
+
+func (o ScanOptions) modifiedIn(mtime time.Time) bool {
+	if !o.ModifiedSince.IsZero() && mtime.Before(o.ModifiedSince) {
+		return false
+	}
+	return o.ModifiedBefore.IsZero() || mtime.Before(o.ModifiedBefore)
+}
+
+func (w *walker) match(fname string) bool {
+	rel, err := filepath.Rel(w.root, fname)
+	if err != nil {
+		rel = fname
+	}
+
+	if matchGlobs(w.opts.Exclude, rel) {
+		return false
+	}
+	if w.opts.ExcludeRegex != nil && w.opts.ExcludeRegex.MatchString(fname) {
+		return false
+	}
+	return len(w.opts.Include) == 0 || matchGlobs(w.opts.Include, rel)
+}
+
+func matchGlobs(patterns []string, rel string) bool {
+	for _, pattern := range patterns {
+		name := filepath.Base(rel)
+		if strings.Contains(pattern, "/") {
+			name = filepath.ToSlash(rel)
+		}
+
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
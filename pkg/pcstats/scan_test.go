@@ -0,0 +1,139 @@
+package pcstats
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScanDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pgcacher")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	assert.Nil(t, os.MkdirAll(filepath.Join(dir, "base", "5"), 0755))
+	assert.Nil(t, os.MkdirAll(filepath.Join(dir, "pg_wal"), 0755))
+	for _, name := range []string{"base/5/16384", "base/5/16384_fsm", "pg_wal/000000010000000000000001", "postgresql.conf"} {
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, name), make([]byte, 8192), 0644))
+	}
+
+	stats, errs := ScanDir(dir, ScanOptions{Exclude: []string{"*.conf", "pg_wal/*"}})
+	assert.Equal(t, []error{nil, nil}, errs)
+	assert.Equal(t, 2, len(stats))
+	assert.Equal(t, filepath.Join(dir, "base", "5", "16384"), stats[0].Name)
+	assert.Equal(t, filepath.Join(dir, "base", "5", "16384_fsm"), stats[1].Name)
+
+	files, _ := WalkFiles(dir, ScanOptions{MaxDepth: 1})
+	assert.Equal(t, []string{filepath.Join(dir, "postgresql.conf")}, files)
+
+	files, _ = WalkFiles(dir, ScanOptions{Include: []string{"*_fsm"}})
+	assert.Equal(t, []string{filepath.Join(dir, "base", "5", "16384_fsm")}, files)
+
+	files, _ = WalkFiles(dir, ScanOptions{Include: []string{"1*"}, Exclude: []string{"*_fsm"}})
+	assert.Equal(t, []string{filepath.Join(dir, "base", "5", "16384")}, files)
+
+	files, _ = WalkFiles(dir, ScanOptions{ExcludeRegex: regexp.MustCompile(`/(base|pg_wal)/`)})
+	assert.Equal(t, []string{filepath.Join(dir, "postgresql.conf")}, files)
+
+	stats, errs = ScanDir(filepath.Join(dir, "nonexistent"), ScanOptions{})
+	assert.Equal(t, 1, len(stats))
+	assert.NotNil(t, errs[0])
+}
+
+func TestEstimateScan(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pgcacher")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	assert.Nil(t, os.MkdirAll(filepath.Join(dir, "base", "5"), 0755))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "base", "5", "16384"), make([]byte, 8192), 0644))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "base", "5", "16385"), make([]byte, 4*8192), 0644))
+
+	files, total, err := EstimateScan(dir, ScanOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, files)
+	assert.Equal(t, int64(5*8192), total)
+
+	files, total, err = EstimateScan(dir, ScanOptions{Batch: BatchOptions{Options: Options{MaxFileSize: 8192}}})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, files)
+	assert.Equal(t, int64(8192), total)
+
+	_, _, err = EstimateScan(filepath.Join(dir, "nonexistent"), ScanOptions{})
+	assert.NotNil(t, err)
+}
+
+func TestScanDirCollapseSegments(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pgcacher")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"16384", "16384.1", "16384.2", "16384_fsm", "16384_fsm.1", "PG_VERSION"} {
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, name), make([]byte, 8192), 0644))
+	}
+
+	stats, errs := ScanDir(dir, ScanOptions{CollapseSegments: true})
+	assert.Equal(t, []error{nil, nil, nil}, errs)
+	assert.Equal(t, 3, len(stats))
+
+	assert.Equal(t, filepath.Join(dir, "16384"), stats[0].Name)
+	assert.Equal(t, int64(3*8192), stats[0].Size)
+	assert.Equal(t, ForkMain, stats[0].Fork)
+	assert.Equal(t, filepath.Join(dir, "16384_fsm"), stats[1].Name)
+	assert.Equal(t, int64(2*8192), stats[1].Size)
+	assert.Equal(t, ForkFSM, stats[1].Fork)
+	assert.Equal(t, filepath.Join(dir, "PG_VERSION"), stats[2].Name)
+}
+
+func TestWalkFilesModified(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pgcacher")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	now := time.Now()
+	for name, age := range map[string]time.Duration{"16384": time.Minute, "16385": time.Hour, "16386": 24 * time.Hour} {
+		fname := filepath.Join(dir, name)
+		assert.Nil(t, ioutil.WriteFile(fname, make([]byte, 8192), 0644))
+		assert.Nil(t, os.Chtimes(fname, now.Add(-age), now.Add(-age)))
+	}
+	assert.Nil(t, os.Symlink(filepath.Join(dir, "16386"), filepath.Join(dir, "old")))
+
+	fnames, _ := WalkFiles(dir, ScanOptions{ModifiedSince: now.Add(-10 * time.Minute)})
+	assert.Equal(t, []string{filepath.Join(dir, "16384")}, fnames)
+
+	fnames, _ = WalkFiles(dir, ScanOptions{ModifiedSince: now.Add(-2 * time.Hour), ModifiedBefore: now.Add(-10 * time.Minute)})
+	assert.Equal(t, []string{filepath.Join(dir, "16385")}, fnames)
+
+	// a symlink is filtered by the mtime of its target.
+	fnames, _ = WalkFiles(dir, ScanOptions{ModifiedBefore: now.Add(-2 * time.Hour)})
+	assert.Equal(t, []string{filepath.Join(dir, "16386"), filepath.Join(dir, "old")}, fnames)
+}
+
+func TestScanDirLabelKinds(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pgcacher")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	assert.Nil(t, os.MkdirAll(filepath.Join(dir, "pg_wal"), 0755))
+	assert.Nil(t, os.MkdirAll(filepath.Join(dir, "base", "5"), 0755))
+	for _, name := range []string{"base/5/16384", "pg_wal/000000010000000000000001", "postgresql.conf", "16385"} {
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, name), make([]byte, 8192), 0644))
+	}
+
+	stats, _ := ScanDir(dir, ScanOptions{LabelKinds: true})
+	kinds := make(map[string]string)
+	for _, pcs := range stats {
+		kinds[filepath.Base(pcs.Name)] = pcs.Kind
+	}
+	assert.Equal(t, map[string]string{
+		"16384":                    KindRelation,
+		"000000010000000000000001": KindWAL,
+		"postgresql.conf":          KindOther,
+		"16385":                    KindOther,
+	}, kinds)
+}
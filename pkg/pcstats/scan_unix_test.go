@@ -0,0 +1,50 @@
+//go:build !windows
+// +build !windows
+
+package pcstats
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScanDirSkipsFifo(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pgcacher")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "16384"), make([]byte, 8192), 0644))
+	assert.Nil(t, syscall.Mkfifo(filepath.Join(dir, "fifo"), 0644))
+
+	stats, errs := ScanDir(dir, ScanOptions{})
+	assert.Equal(t, []error{nil}, errs)
+	assert.Equal(t, 1, len(stats))
+	assert.Equal(t, filepath.Join(dir, "16384"), stats[0].Name)
+}
+
+func TestEstimateScanSymlinks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pgcacher")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "16384"), make([]byte, 8192), 0644))
+	// a symlink counts the size of its target, a loop can't be stat'ed.
+	assert.Nil(t, os.Symlink(filepath.Join(dir, "16384"), filepath.Join(dir, "link")))
+	assert.Nil(t, os.Symlink(filepath.Join(dir, "loop"), filepath.Join(dir, "loop")))
+	assert.Nil(t, os.Symlink(filepath.Join(dir, "gone"), filepath.Join(dir, "dangling")))
+
+	files, total, err := EstimateScan(dir, ScanOptions{})
+	assert.Equal(t, 2, files)
+	assert.Equal(t, int64(2*8192), total)
+
+	var perr *os.PathError
+	assert.True(t, errors.As(err, &perr))
+	assert.Equal(t, "stat", perr.Op)
+	assert.Equal(t, filepath.Join(dir, "loop"), perr.Path)
+}
@@ -0,0 +1,370 @@
+package pcstats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrScannerClosed is returned by Scan for every file once the Scanner
+	// is closed.
+	ErrScannerClosed = errors.New("scanner is closed")
+
+	// ErrBatchBitmap is returned by Scan for every file when the options
+	// have a Bitmap, which only holds the residency of a single file.
+	ErrBatchBitmap = errors.New("Options.Bitmap can't be shared by the files of a batch")
+)
+
+// Scanner is GetPcStatusBatch with the workers kept between the scans, such
+// as for an agent scanning the same relations every few seconds. the scans
+// may run concurrently, they share the workers, the Throttle of the
+// options applies across all of them.
+type Scanner struct {
+	opts   BatchOptions
+	ctx    context.Context
+	jobs   chan scanJob
+	wg     sync.WaitGroup
+	ticker *time.Ticker
+	mapped chan struct{}
+
+	// mu guards the sends to jobs against their close.
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewScanner starts the Concurrency workers of opts, they live until Close.
+func NewScanner(opts BatchOptions) *Scanner {
+	workers := opts.Concurrency
+	if workers <= 0 {
+		workers = 1
+	}
+
+	s := &Scanner{
+		opts: opts,
+		ctx:  withLogger(context.Background(), opts.Logger),
+		jobs: make(chan scanJob, workers),
+	}
+	if rate := opts.Throttle.FilesPerSecond; rate > 0 {
+		s.ticker = time.NewTicker(time.Duration(float64(time.Second) / rate))
+	}
+	if max := opts.Throttle.MaxMapped; max > 0 && max < workers {
+		s.mapped = make(chan struct{}, max)
+	}
+
+	for i := 0; i < workers; i++ {
+		s.wg.Add(1)
+		go s.work()
+	}
+	return s
+}
+
+func (s *Scanner) work() {
+	defer s.wg.Done()
+
+	for job := range s.jobs {
+		if s.ticker != nil {
+			<-s.ticker.C
+		}
+		if s.mapped != nil {
+			s.mapped <- struct{}{}
+		}
+		s.runJob(job)
+		if s.mapped != nil {
+			<-s.mapped
+		}
+		if s.opts.Throttle.Delay > 0 {
+			time.Sleep(s.opts.Throttle.Delay)
+		}
+	}
+}
+
+// scanState is a scan in flight, shared by its jobs. every job only writes
+// its own slots, so no lock is needed but for the progress.
+type scanState struct {
+	fnames    []string
+	modes     []uint32
+	stats     []PcStatus
+	errs      []error
+	durations []time.Duration
+	wg        sync.WaitGroup
+
+	progressMu sync.Mutex
+	done       int
+}
+
+// scanJob is the file idx of the scan, sent to the workers by value so a
+// file costs no allocation.
+type scanJob struct {
+	scan *scanState
+	idx  int
+}
+
+// runJob scans the file of the job into the slots of its scan. the scan of
+// a file abandoned by PerFileTimeout still holds the worker, and its mapped
+// slot, until it returns, so the scans in the background are bounded by
+// Concurrency and MaxMapped, but its slots are filled right away.
+func (s *Scanner) runJob(job scanJob) {
+	scan, idx := job.scan, job.idx
+
+	var mode uint32
+	if scan.modes != nil {
+		mode = scan.modes[idx]
+	}
+	fileStart := time.Now()
+	pcs, abandoned, err := s.scanFile(scan.fnames[idx], mode)
+	scan.stats[idx], scan.errs[idx] = pcs, err
+	scan.durations[idx] = time.Since(fileStart)
+
+	if s.opts.OnProgress != nil {
+		scan.progressMu.Lock()
+		scan.done++
+		s.opts.OnProgress(scan.done, len(scan.fnames), scan.fnames[idx])
+		scan.progressMu.Unlock()
+	}
+	scan.wg.Done()
+
+	if abandoned != nil {
+		<-abandoned
+	}
+}
+
+// ScanStats is the cost of a scan itself, rather than the page cache of
+// the files, such as for scheduling the audits of a busy database host.
+type ScanStats struct {
+	Duration time.Duration `json:"duration" yaml:"duration"` // wall time of the whole scan
+
+	// the durations of the files, from the start of the scan of a file by
+	// a worker to its end, 0 without files.
+	MinFileDuration time.Duration `json:"min_file_duration" yaml:"min_file_duration"`
+	AvgFileDuration time.Duration `json:"avg_file_duration" yaml:"avg_file_duration"`
+	MaxFileDuration time.Duration `json:"max_file_duration" yaml:"max_file_duration"`
+
+	Files   int `json:"files" yaml:"files"`     // files processed, including the skipped and failed ones
+	Skipped int `json:"skipped" yaml:"skipped"` // files with Skipped set
+	Failed  int `json:"failed" yaml:"failed"`   // files with an error
+
+	// BytesScanned sums the ranges of the files whose residency was
+	// queried, by mincore or cachestat, the whole range even if Sample or
+	// StopIfCold only looked at part of it.
+	BytesScanned int64 `json:"bytes_scanned" yaml:"bytes_scanned"`
+}
+
+// FilesPerSecond is the rate of the scan, 0 for an empty scan.
+func (ss ScanStats) FilesPerSecond() float64 {
+	if ss.Duration <= 0 {
+		return 0
+	}
+	return float64(ss.Files) / ss.Duration.Seconds()
+}
+
+// scanStats computes the ScanStats of the results of a scan, before the
+// percent filter drops any of them.
+func scanStats(stats []PcStatus, errs []error, durations []time.Duration, total time.Duration) ScanStats {
+	ss := ScanStats{Duration: total, Files: len(stats)}
+	var sum time.Duration
+	for idx, d := range durations {
+		sum += d
+		if idx == 0 || d < ss.MinFileDuration {
+			ss.MinFileDuration = d
+		}
+		if d > ss.MaxFileDuration {
+			ss.MaxFileDuration = d
+		}
+	}
+	if len(durations) > 0 {
+		ss.AvgFileDuration = sum / time.Duration(len(durations))
+	}
+
+	for idx, pcs := range stats {
+		switch {
+		case errs[idx] != nil:
+			ss.Failed++
+		case pcs.Skipped:
+			ss.Skipped++
+		default:
+			length := pcs.Length
+			if length == 0 {
+				length = pcs.Size - pcs.Offset
+			}
+			if length > 0 {
+				ss.BytesScanned += length
+			}
+		}
+	}
+	return ss
+}
+
+// Scan gets the page cache status of the files by the workers, the results
+// are the same as GetPcStatusBatch of the options of NewScanner.
+func (s *Scanner) Scan(fnames []string) ([]PcStatus, []error) {
+	stats, errs, _ := s.ScanWithStats(fnames)
+	return stats, errs
+}
+
+// ScanWithStats is Scan which also returns the ScanStats of the scan, the
+// stats count all of fnames, including the files dropped by the percent
+// filter.
+func (s *Scanner) ScanWithStats(fnames []string) ([]PcStatus, []error, ScanStats) {
+	var (
+		logger = s.opts.logger()
+		start  = time.Now()
+	)
+	if s.opts.Options.Bitmap != nil {
+		return failAll(fnames, ErrBatchBitmap, start)
+	}
+
+	scan := &scanState{
+		fnames:    fnames,
+		stats:     make([]PcStatus, len(fnames)),
+		errs:      make([]error, len(fnames)),
+		durations: make([]time.Duration, len(fnames)),
+	}
+	// the statx of the ring resolves the paths in the root of pgcacher.
+	if s.opts.IOUringPrestat && s.opts.Options.MountNamespacePID <= 0 {
+		scan.modes = prestatFiles(fnames)
+		if scan.modes == nil {
+			logger.Debug("io_uring isn't available, stat the files one by one")
+		}
+	}
+
+	s.mu.RLock()
+	if s.closed {
+		s.mu.RUnlock()
+		return failAll(fnames, ErrScannerClosed, start)
+	}
+
+	scan.wg.Add(len(fnames))
+	for idx := range fnames {
+		s.jobs <- scanJob{scan: scan, idx: idx}
+	}
+	s.mu.RUnlock()
+
+	scan.wg.Wait()
+	stats, errs := scan.stats, scan.errs
+	ss := scanStats(stats, errs, scan.durations, time.Since(start))
+	logger.Info("scanned %d files in %v", len(fnames), ss.Duration)
+
+	if s.opts.hasPercentFilter() {
+		stats, errs = filterPercent(stats, errs, s.opts)
+	}
+	if s.opts.SortByName {
+		sortByName(stats, errs)
+	}
+	return stats, errs, ss
+}
+
+// failAll is the result of a scan which fails every file with err.
+func failAll(fnames []string, err error, start time.Time) ([]PcStatus, []error, ScanStats) {
+	stats := make([]PcStatus, len(fnames))
+	errs := make([]error, len(fnames))
+	for idx, fname := range fnames {
+		stats[idx] = PcStatus{Name: fname, Error: err.Error()}
+		errs[idx] = err
+	}
+	return stats, errs, scanStats(stats, errs, nil, time.Since(start))
+}
+
+// scanFile scans a file, by the mode of the prestat if it isn't 0. the
+// channel is of scanFileTimeout.
+func (s *Scanner) scanFile(fname string, mode uint32) (PcStatus, <-chan struct{}, error) {
+	pcs, abandoned, err := s.scanFileTimeout(fname, mode)
+	if s.opts.SkipPermissionDenied && errors.Is(err, ErrPermission) {
+		pcs.Skipped, pcs.SkipReason = true, SkipPermission
+		err = nil
+	}
+
+	logger := s.opts.logger()
+	switch {
+	case err != nil:
+		pcs.Error = err.Error()
+		logger.Warn("could not scan %q: %v", fname, err)
+	case pcs.Skipped:
+		logger.Debug("skipped %q: %s", fname, pcs.SkipReason)
+	}
+	return pcs, abandoned, err
+}
+
+// scanFileTimeout runs the scan of the file under PerFileTimeout. a scan
+// over it is abandoned, the returned channel is closed once it returns, nil
+// when the scan has already returned.
+func (s *Scanner) scanFileTimeout(fname string, mode uint32) (PcStatus, <-chan struct{}, error) {
+	scan := func(ctx context.Context) (PcStatus, error) {
+		if mode != 0 {
+			return getPrestatStatus(ctx, fname, mode, s.opts)
+		}
+		return GetPcStatusContext(ctx, fname, s.opts.Filter, s.opts.Options)
+	}
+	if s.opts.PerFileTimeout <= 0 {
+		pcs, err := scan(s.ctx)
+		return pcs, nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(s.ctx, s.opts.PerFileTimeout)
+	defer cancel()
+
+	type result struct {
+		pcs PcStatus
+		err error
+	}
+	var (
+		done     = make(chan result, 1)
+		finished = make(chan struct{})
+	)
+	go func() {
+		defer close(finished)
+		pcs, err := scan(ctx)
+		done <- result{pcs, err}
+	}()
+
+	select {
+	case res := <-done:
+		if errors.Is(res.err, context.DeadlineExceeded) {
+			res.err = fmt.Errorf("%w after %v", ErrTimeout, s.opts.PerFileTimeout)
+		}
+		return res.pcs, nil, res.err
+	case <-ctx.Done():
+		return PcStatus{Name: fname, Fork: RelationFork(fname)}, finished, fmt.Errorf("%w after %v", ErrTimeout, s.opts.PerFileTimeout)
+	}
+}
+
+// Close waits for the scans in flight, including the ones abandoned by
+// PerFileTimeout, and stops the workers, the later scans fail with
+// ErrScannerClosed. it's safe to call more than once.
+func (s *Scanner) Close() {
+	if !s.shutdown() {
+		return
+	}
+
+	s.wg.Wait()
+	if s.ticker != nil {
+		s.ticker.Stop()
+	}
+}
+
+// detach is Close without waiting for the scans abandoned by
+// PerFileTimeout, their workers exit once they return. it's only for the
+// Scanner of a single scan which has returned, so no job is left queued.
+func (s *Scanner) detach() {
+	if !s.shutdown() {
+		return
+	}
+
+	if s.ticker != nil {
+		s.ticker.Stop()
+	}
+}
+
+// shutdown closes the jobs, it returns false when they are already closed.
+func (s *Scanner) shutdown() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	s.closed = true
+	close(s.jobs)
+	return true
+}
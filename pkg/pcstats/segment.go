@@ -0,0 +1,266 @@
+package pcstats
+
+import (
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// SumPcStatus merges the page cache status of the segments of one relation,
+// such as 16384, 16384.1 and 16384.2, into a single summary. the name of the
+// result is the base relfilenode without the segment suffix. the counters are
+// summed, the summary is Approximate or Truncated if any segment is, and its
+// WeightedPercent is the one of the segments weighted by their Pages.
+func SumPcStatus(statuses []PcStatus) PcStatus {
+	var (
+		sum      PcStatus
+		weighted float64
+	)
+	if len(statuses) == 0 {
+		return sum
+	}
+
+	sum.Name = TrimSegmentSuffix(statuses[0].Name)
+	sum.Fork = statuses[0].Fork
+	for _, pcs := range statuses {
+		if pcs.Fork != sum.Fork {
+			sum.Fork = ""
+		}
+
+		sum.Size += pcs.Size
+		sum.Allocated += pcs.Allocated
+		sum.Pages += pcs.Pages
+		sum.Cached += pcs.Cached
+		sum.CachedBytes += pcs.CachedBytes
+		sum.CachedBlocks += pcs.CachedBlocks
+		sum.Uncached += pcs.Uncached
+		sum.Dirty += pcs.Dirty
+		sum.IdleCached += pcs.IdleCached
+		sum.Sparse += pcs.Sparse
+		sum.CachedBeyondEOF += pcs.CachedBeyondEOF
+		sum.Approximate = sum.Approximate || pcs.Approximate
+		sum.Truncated = sum.Truncated || pcs.Truncated
+		weighted += pcs.WeightedPercent * float64(pcs.Pages)
+
+		if pcs.Mtime.After(sum.Mtime) {
+			sum.Mtime = pcs.Mtime
+		}
+		if pcs.Timestamp.After(sum.Timestamp) {
+			sum.Timestamp = pcs.Timestamp
+		}
+	}
+
+	sum.Age = sum.Timestamp.Sub(sum.Mtime)
+
+	if sum.Pages != 0 {
+		sum.Percent = (float64(sum.Cached) / float64(sum.Pages)) * 100.00
+		sum.WeightedPercent = weighted / float64(sum.Pages)
+	}
+	return sum
+}
+
+// collapseSegments merges the statuses of the segments of the same relation
+// fork by SumPcStatus, in the order of their first segments. the statuses
+// with errors and of the files which aren't relations are kept as is.
+func collapseSegments(stats []PcStatus, errs []error) ([]PcStatus, []error) {
+	var (
+		outStats = make([]PcStatus, 0, len(stats))
+		outErrs  = make([]error, 0, len(errs))
+		segments = make(map[string][]PcStatus)
+		places   = make(map[string]int)
+	)
+
+	for idx, pcs := range stats {
+		if errs[idx] != nil || RelationFork(pcs.Name) == "" {
+			outStats = append(outStats, pcs)
+			outErrs = append(outErrs, errs[idx])
+			continue
+		}
+
+		base := TrimSegmentSuffix(pcs.Name)
+		if _, ok := places[base]; !ok {
+			places[base] = len(outStats)
+			outStats = append(outStats, PcStatus{})
+			outErrs = append(outErrs, nil)
+		}
+		segments[base] = append(segments[base], pcs)
+	}
+
+	for base, place := range places {
+		outStats[place] = SumPcStatus(segments[base])
+	}
+	return outStats, outErrs
+}
+
+// TrimSegmentSuffix removes the `.N` segment number from the file name,
+// `base/5/16384.2` becomes `base/5/16384`.
+func TrimSegmentSuffix(name string) string {
+	idx := strings.LastIndexByte(name, '.')
+	if idx < 0 || idx < len(name)-len(path.Base(name)) {
+		return name
+	}
+
+	if !isDigits(name[idx+1:]) {
+		return name
+	}
+	return name[:idx]
+}
+
+// the fork names of RelationFork.
+const (
+	ForkMain = "main"
+	ForkFSM  = "fsm"
+	ForkVM   = "vm"
+	ForkInit = "init"
+)
+
+// RelationFile is a data file of a postgresql relation parsed by
+// ParseRelationFile.
+type RelationFile struct {
+	Relfilenode string // such as `16384`, or `t3_16384` of a temporary relation
+	Fork        string // one of the fork names
+	Segment     int    // the `.N` segment number, 0 for the first segment
+}
+
+// ParseRelationFile parses the base name of a relation file by the grammar
+// `[t<backend>_]<relfilenode>[_<fork>][.<segment>]`, such as `16384`,
+// `16384.1`, `16384_fsm.1` and `t3_16384_vm`, the oids are uint32. it's the
+// only parser of the names of the relation files, whatever directory they
+// are in, see IsRelationFile for the directories. it returns false for the
+// other names, such as `16384.3_fsm`, the segment number comes after the
+// fork.
+func ParseRelationFile(name string) (RelationFile, bool) {
+	var rf RelationFile
+	base := path.Base(name)
+	if idx := strings.LastIndexByte(base, '.'); idx >= 0 {
+		if !isDigits(base[idx+1:]) {
+			return rf, false
+		}
+		seg, err := strconv.Atoi(base[idx+1:])
+		if err != nil {
+			return rf, false
+		}
+		rf.Segment, base = seg, base[:idx]
+	}
+
+	rf.Fork = ForkMain
+	for _, f := range []string{ForkFSM, ForkVM, ForkInit} {
+		if strings.HasSuffix(base, "_"+f) {
+			rf.Fork, base = f, strings.TrimSuffix(base, "_"+f)
+			break
+		}
+	}
+
+	// the temporary relations are t<backend>_<relfilenode>.
+	node := base
+	if strings.HasPrefix(base, "t") {
+		ids := strings.SplitN(base[1:], "_", 2)
+		if len(ids) != 2 || !isOid(ids[0]) {
+			return rf, false
+		}
+		node = ids[1]
+	}
+	// an oid is an uint32, which also rejects the wal segments, such as
+	// 000000010000000000000001.
+	if !isOid(node) {
+		return rf, false
+	}
+	rf.Relfilenode = base
+	return rf, true
+}
+
+// RelationFork returns the fork of the relation file by ParseRelationFile,
+// `16384` and `16384.1` are main, `16384_fsm.1` is the second segment of
+// fsm. it returns "" if the name isn't a relfilenode.
+func RelationFork(name string) string {
+	rf, ok := ParseRelationFile(name)
+	if !ok {
+		return ""
+	}
+	return rf.Fork
+}
+
+// IsRelationFile reports whether path looks like a data file of a relation,
+// its base name is of ParseRelationFile and it's under `base/<dboid>/`,
+// `global/` or `pg_tblspc/<spcoid>/<version>/<dboid>/`, so the files of
+// pg_wal, pg_stat_tmp, the configs and locks are rejected.
+func IsRelationFile(name string) bool {
+	parts := strings.Split(filepath.ToSlash(filepath.Clean(name)), "/")
+	if len(parts) < 2 {
+		return false
+	}
+	if _, ok := ParseRelationFile(parts[len(parts)-1]); !ok {
+		return false
+	}
+
+	dirs := parts[:len(parts)-1]
+	n := len(dirs)
+	switch {
+	case dirs[n-1] == "global":
+		return true
+	case n >= 2 && dirs[n-2] == "base" && isOid(dirs[n-1]):
+		return true
+	case n >= 4 && dirs[n-4] == "pg_tblspc" && isOid(dirs[n-3]) &&
+		strings.HasPrefix(dirs[n-2], "PG_") && isOid(dirs[n-1]):
+		return true
+	}
+	return false
+}
+
+// IsWALFile reports whether the base name of the file is a wal segment of
+// pg_wal, 24 hex digits of the timeline, the log and the segment, such as
+// 000000010000000000000023, or such a segment with the .partial suffix left
+// by a promotion.
+func IsWALFile(name string) bool {
+	base := strings.TrimSuffix(path.Base(name), ".partial")
+	if len(base) != 24 {
+		return false
+	}
+	for _, c := range base {
+		if (c < '0' || c > '9') && (c < 'A' || c > 'F') {
+			return false
+		}
+	}
+	return true
+}
+
+// the kinds of FileKind.
+const (
+	KindRelation = "relation"
+	KindWAL      = "wal"
+	KindOther    = "other"
+)
+
+// FileKind classifies the file by its name, KindRelation for the files of
+// IsRelationFile, KindWAL for IsWALFile, KindOther for the rest.
+func FileKind(name string) string {
+	switch {
+	case IsRelationFile(name):
+		return KindRelation
+	case IsWALFile(name):
+		return KindWAL
+	}
+	return KindOther
+}
+
+// isOid reports whether s is the decimal of an uint32.
+func isOid(s string) bool {
+	if !isDigits(s) {
+		return false
+	}
+	_, err := strconv.ParseUint(s, 10, 32)
+	return err == nil
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
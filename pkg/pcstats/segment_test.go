@@ -0,0 +1,129 @@
+package pcstats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSumPcStatus(t *testing.T) {
+	now := time.Now()
+	stats := []PcStatus{
+		{Name: "base/5/16384", Size: 8192, Pages: 2, Cached: 2, Mtime: now.Add(-time.Hour)},
+		{Name: "base/5/16384.1", Size: 8192, Pages: 2, Cached: 0, Uncached: 2, Mtime: now},
+	}
+
+	sum := SumPcStatus(stats)
+	assert.Equal(t, "base/5/16384", sum.Name)
+	assert.Equal(t, int64(16384), sum.Size)
+	assert.Equal(t, 4, sum.Pages)
+	assert.Equal(t, 2, sum.Cached)
+	assert.Equal(t, 2, sum.Uncached)
+	assert.Equal(t, now, sum.Mtime)
+	assert.Equal(t, 50.0, sum.Percent)
+
+	assert.False(t, sum.Approximate)
+
+	// a sampled segment makes the summary approximate.
+	stats = []PcStatus{
+		{Name: "base/5/16384", Pages: 2, Cached: 2, Dirty: 1, IdleCached: 1, WeightedPercent: 100},
+		{Name: "base/5/16384.1", Pages: 6, Cached: 3, Uncached: 3, Dirty: 2, Sparse: 1, CachedBeyondEOF: 1, Approximate: true, WeightedPercent: 20},
+		{Name: "base/5/16384.2", Truncated: true},
+	}
+	sum = SumPcStatus(stats)
+	assert.True(t, sum.Approximate)
+	assert.True(t, sum.Truncated)
+	assert.Equal(t, 3, sum.Dirty)
+	assert.Equal(t, 1, sum.IdleCached)
+	assert.Equal(t, 1, sum.Sparse)
+	assert.Equal(t, 1, sum.CachedBeyondEOF)
+	assert.Equal(t, 62.5, sum.Percent)
+	assert.Equal(t, 40.0, sum.WeightedPercent)
+
+	empty := SumPcStatus(nil)
+	assert.Equal(t, 0.0, empty.Percent)
+}
+
+func TestTrimSegmentSuffix(t *testing.T) {
+	assert.Equal(t, "16384", TrimSegmentSuffix("16384.12"))
+	assert.Equal(t, "/pg/v1.2/16384", TrimSegmentSuffix("/pg/v1.2/16384"))
+	assert.Equal(t, "16384_fsm", TrimSegmentSuffix("16384_fsm"))
+	assert.Equal(t, "16384.", TrimSegmentSuffix("16384."))
+}
+
+func TestTotals(t *testing.T) {
+	now := time.Now()
+	stats := []PcStatus{
+		{Name: "small", Timestamp: now, Size: 4096, Pages: 1, Cached: 1},
+		{Name: "big", Timestamp: now, Size: 4096 * 99, Pages: 99, Cached: 0, Uncached: 99},
+		{Name: "failed"},
+	}
+
+	total := Totals(stats)
+	assert.Equal(t, TotalName, total.Name)
+	assert.Equal(t, int64(4096*100), total.Size)
+	assert.Equal(t, 100, total.Pages)
+	assert.Equal(t, 1, total.Cached)
+	assert.Equal(t, 99, total.Uncached)
+	assert.Equal(t, 1.0, total.Percent)
+}
+
+func TestWorkingSetBytes(t *testing.T) {
+	now := time.Now()
+	stats := []PcStatus{
+		{Name: "partial", Timestamp: now, Size: 100, Pages: 1, Cached: 1, CachedBytes: 100},
+		{Name: "full", Timestamp: now, Size: 8192, Pages: 2, Cached: 2, CachedBytes: 8192},
+		{Name: "failed", CachedBytes: 4096},
+	}
+	assert.Equal(t, int64(8292), WorkingSetBytes(stats))
+	assert.Equal(t, int64(0), WorkingSetBytes(nil))
+}
+
+func TestFileKind(t *testing.T) {
+	assert.True(t, IsWALFile("pg_wal/000000010000000000000023"))
+	assert.True(t, IsWALFile("pg_wal/00000002000000000000000A.partial"))
+	assert.False(t, IsWALFile("pg_wal/00000002.history"))
+	assert.False(t, IsWALFile("pg_wal/00000001000000000000000a"))
+	assert.False(t, IsWALFile("base/5/16384"))
+
+	assert.Equal(t, KindWAL, FileKind("pg_wal/000000010000000000000023"))
+	assert.Equal(t, KindRelation, FileKind("base/5/16384_fsm"))
+	assert.Equal(t, KindOther, FileKind("postgresql.conf"))
+}
+
+func TestRelationFork(t *testing.T) {
+	assert.Equal(t, ForkMain, RelationFork("base/5/16384"))
+	assert.Equal(t, ForkMain, RelationFork("base/5/16384.3"))
+	assert.Equal(t, ForkFSM, RelationFork("base/5/16384_fsm"))
+	assert.Equal(t, ForkFSM, RelationFork("base/5/16384_fsm.1"))
+	assert.Equal(t, ForkVM, RelationFork("base/5/16384_vm"))
+	assert.Equal(t, ForkInit, RelationFork("base/5/16384_init"))
+	assert.Equal(t, ForkVM, RelationFork("base/5/t3_16384_vm"))
+
+	assert.Equal(t, "", RelationFork("base/5/16384.3_fsm"))
+	assert.Equal(t, "", RelationFork("base/5/pg_filenode.map"))
+	assert.Equal(t, "", RelationFork("pg_wal/000000010000000000000001.partial"))
+	assert.Equal(t, "", RelationFork("pg_wal/000000010000000000000001"))
+	assert.Equal(t, "", RelationFork("/var/log/messages.1"))
+	assert.Equal(t, "", RelationFork("base/5/99999999999"))
+}
+
+func TestParseRelationFile(t *testing.T) {
+	rf, ok := ParseRelationFile("/pgdata/base/5/16384_fsm.2")
+	assert.True(t, ok)
+	assert.Equal(t, RelationFile{Relfilenode: "16384", Fork: ForkFSM, Segment: 2}, rf)
+
+	rf, ok = ParseRelationFile("t3_16390_vm")
+	assert.True(t, ok)
+	assert.Equal(t, RelationFile{Relfilenode: "t3_16390", Fork: ForkVM}, rf)
+
+	for _, name := range []string{"16384.", "16384.+1", "16384_xyz", "t_16384", "4294967296", "pg_control"} {
+		_, ok := ParseRelationFile(name)
+		assert.False(t, ok, name)
+	}
+
+	assert.True(t, IsRelationFile("/pgdata/pg_tblspc/16400/PG_14_202107181/5/16401.1"))
+	assert.False(t, IsRelationFile("/var/log/16384"))
+	assert.Equal(t, KindOther, FileKind("/var/log/16384"))
+}
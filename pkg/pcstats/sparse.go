@@ -0,0 +1,80 @@
+package pcstats
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+)
+
+// countSparsePages returns the number of uncached pages which are fully in
+// the holes of the file, found by SEEK_DATA and SEEK_HOLE. there is no data
+// to cache in them, the cached pages of holes still occupy the memory, so
+// they aren't counted. it returns 0 if the filesystem doesn't support them.
+// the file offset, which may be of the caller such as by
+// GetPcStatusFromFile, is restored after the seeks, an error is only
+// returned when it can't be.
+func countSparsePages(f *os.File, size int64, pageSize int, bitmap []bool) (int, error) {
+	saved, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, fmt.Errorf("could not get the file offset: %v", err)
+	}
+	holes, err := getHoles(f, size)
+	if _, serr := f.Seek(saved, io.SeekStart); serr != nil {
+		return 0, fmt.Errorf("could not restore the file offset: %v", serr)
+	}
+	if err != nil {
+		return 0, nil
+	}
+
+	var sparse int
+	psz := int64(pageSize)
+	for _, hole := range holes {
+		// only the pages fully in the hole.
+		first := (hole.start + psz - 1) / psz
+		for idx := first; idx < int64(len(bitmap)); idx++ {
+			if min64((idx+1)*psz, size) > hole.end {
+				break
+			}
+			if !bitmap[idx] {
+				sparse++
+			}
+		}
+	}
+	return sparse, nil
+}
+
+type byteRange struct {
+	start, end int64
+}
+
+// getHoles returns the holes of [0, size) of the file.
+func getHoles(f *os.File, size int64) ([]byteRange, error) {
+	var (
+		holes []byteRange
+		off   int64
+	)
+
+	for off < size {
+		data, err := f.Seek(off, seekData)
+		if errors.Is(err, syscall.ENXIO) {
+			// no data after off, the rest is a hole.
+			holes = append(holes, byteRange{off, size})
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if data > off {
+			holes = append(holes, byteRange{off, min64(data, size)})
+		}
+
+		off, err = f.Seek(data, seekHole)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return holes, nil
+}
@@ -0,0 +1,41 @@
+//go:build !windows
+// +build !windows
+
+package pcstats
+
+import (
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// allocatedSize returns the bytes allocated to the file, st_blocks is always
+// in the units of 512 bytes.
+func allocatedSize(finfo os.FileInfo) int64 {
+	st, ok := finfo.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0
+	}
+	return int64(st.Blocks) * 512
+}
+
+// fileID returns the device and inode of the file, which identify the
+// hardlinks of the same file.
+func fileID(finfo os.FileInfo) (uint64, uint64) {
+	st, ok := finfo.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0
+	}
+	return uint64(st.Dev), uint64(st.Ino)
+}
+
+// kernelRelease returns the release of uname(2), such as 6.1.0-18-amd64, or
+// "" if it fails.
+func kernelRelease() string {
+	var uts unix.Utsname
+	if err := unix.Uname(&uts); err != nil {
+		return ""
+	}
+	return unix.ByteSliceToString(uts.Release[:])
+}
@@ -0,0 +1,203 @@
+package pcstats
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// SortKey is the key to sort the statuses by.
+type SortKey int
+
+const (
+	SortByName          SortKey = iota // file name, ascending
+	SortByPercent                      // percent cached, descending
+	SortBySize                         // file size, descending
+	SortByCachedBytes                  // cached bytes, descending
+	SortByUncachedBytes                // uncached bytes, descending
+)
+
+// TableOptions controls the output of FormatTable.
+type TableOptions struct {
+	// SortBy is the column to sort the rows by.
+	SortBy SortKey
+
+	// MaxNameLen truncates the names longer than it from the left, so the
+	// basename stays visible, 0 means no truncation.
+	MaxNameLen int
+
+	// RelName adds the RELATION column of PcStatus.RelName.
+	RelName bool
+
+	// DirectIO adds the DIRECT IO column of PcStatus.DirectIO.
+	DirectIO bool
+}
+
+// header returns the header row of the columns of the options.
+func (o TableOptions) header() string {
+	header := "NAME\tSIZE\tCACHED\tPAGES\tPERCENT"
+	if o.RelName {
+		header += "\tRELATION"
+	}
+	if o.DirectIO {
+		header += "\tDIRECT IO"
+	}
+	return header
+}
+
+const tableBarWidth = 10
+
+// FormatTable writes the statuses as an aligned table with name, size,
+// cached pages, total pages and percent with an inline bar.
+func FormatTable(w io.Writer, statuses []PcStatus, opts TableOptions) error {
+	stats := make([]PcStatus, len(statuses))
+	copy(stats, statuses)
+	sortStatuses(stats, opts.SortBy)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, opts.header())
+	for _, pcs := range stats {
+		writeTableRow(tw, truncateName(pcs.Name, opts.MaxNameLen), pcs, opts)
+	}
+	return tw.Flush()
+}
+
+// FormatGrouped writes the groups of GroupByDatabase as the sections of one
+// aligned table, the databases are sorted by name and every section ends
+// with a subtotal row, the last row is the grand total of all the groups.
+func FormatGrouped(w io.Writer, groups map[string][]PcStatus, opts TableOptions) error {
+	dbs := make([]string, 0, len(groups))
+	for db := range groups {
+		dbs = append(dbs, db)
+	}
+	sort.Strings(dbs)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, opts.header())
+
+	var all []PcStatus
+	for _, db := range dbs {
+		stats := make([]PcStatus, len(groups[db]))
+		copy(stats, groups[db])
+		sortStatuses(stats, opts.SortBy)
+
+		fmt.Fprintf(tw, "[%s]\t\t\t\t\n", db)
+		for _, pcs := range stats {
+			writeTableRow(tw, truncateName(pcs.Name, opts.MaxNameLen), pcs, opts)
+		}
+
+		writeTableRow(tw, "SUBTOTAL "+db, Totals(stats), opts)
+		all = append(all, stats...)
+	}
+
+	writeTableRow(tw, TotalName, Totals(all), opts)
+	return tw.Flush()
+}
+
+func writeTableRow(w io.Writer, name string, pcs PcStatus, opts TableOptions) {
+	fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s %6.2f%%",
+		name, humanSize(pcs.Size), pcs.Cached, pcs.Pages, percentBar(pcs.Percent), pcs.Percent)
+	if opts.RelName {
+		fmt.Fprintf(w, "\t%s", pcs.RelName)
+	}
+	if opts.DirectIO {
+		fmt.Fprintf(w, "\t%s", directIOCell(pcs.DirectIO))
+	}
+	fmt.Fprintln(w)
+}
+
+// sortStatuses sorts the statuses in place, ties break by name.
+func sortStatuses(stats []PcStatus, by SortKey) {
+	sort.SliceStable(stats, func(i, j int) bool {
+		a, b := stats[i], stats[j]
+		switch by {
+		case SortByPercent:
+			if a.Percent != b.Percent {
+				return a.Percent > b.Percent
+			}
+		case SortBySize:
+			if a.Size != b.Size {
+				return a.Size > b.Size
+			}
+		case SortByCachedBytes:
+			if ca, cb := cachedBytes(a), cachedBytes(b); ca != cb {
+				return ca > cb
+			}
+		case SortByUncachedBytes:
+			if ua, ub := a.Size-cachedBytes(a), b.Size-cachedBytes(b); ua != ub {
+				return ua > ub
+			}
+		}
+		return a.Name < b.Name
+	})
+}
+
+// TopN returns the first n statuses sorted by the key, such as the files
+// hogging the page cache by SortByCachedBytes, ties break by name.
+func TopN(statuses []PcStatus, n int, by SortKey) []PcStatus {
+	stats := make([]PcStatus, len(statuses))
+	copy(stats, statuses)
+	sortStatuses(stats, by)
+
+	if n < 0 {
+		n = 0
+	}
+	if n < len(stats) {
+		stats = stats[:n]
+	}
+	return stats
+}
+
+// cachedBytes prefers PcStatus.CachedBytes, the statuses built by hand may
+// leave it 0, then it's calculated by the size and percent, which isn't
+// completely accurate as the cache is counted through pages.
+func cachedBytes(pcs PcStatus) int64 {
+	if pcs.CachedBytes != 0 {
+		return pcs.CachedBytes
+	}
+	return int64(float64(pcs.Size) * pcs.Percent / 100)
+}
+
+func truncateName(name string, max int) string {
+	if max <= 3 || len(name) <= max {
+		return name
+	}
+	return "..." + name[len(name)-max+3:]
+}
+
+func percentBar(percent float64) string {
+	n := int(percent / 100 * tableBarWidth)
+	if n > tableBarWidth {
+		n = tableBarWidth
+	}
+	if n < 0 {
+		n = 0
+	}
+	return "[" + strings.Repeat("#", n) + strings.Repeat(" ", tableBarWidth-n) + "]"
+}
+
+// humanSize converts the bytes to a short readable string, such as 1.2G.
+func humanSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%dB", size)
+	}
+
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%c", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+// directIOCell returns the DIRECT IO cell of the table, empty when the file
+// isn't read with O_DIRECT so the column stays easy to scan.
+func directIOCell(directIO bool) string {
+	if directIO {
+		return "yes"
+	}
+	return ""
+}
@@ -0,0 +1,219 @@
+package pcstats
+
+import (
+	"runtime"
+	"sync/atomic"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// the io_uring abi of <linux/io_uring.h>, only what the statx of
+// prestatFiles needs.
+const (
+	uringOpStatx        = 21 // IORING_OP_STATX, since linux 5.6
+	uringEnterGetEvents = 1  // IORING_ENTER_GETEVENTS
+	uringOffSQRing      = 0
+	uringOffCQRing      = 0x8000000
+	uringOffSQEs        = 0x10000000
+
+	// uringEntries is the number of statx in flight.
+	uringEntries = 256
+)
+
+type uringSQOffsets struct {
+	head, tail, ringMask, ringEntries, flags, dropped, array, resv1 uint32
+	resv2                                                           uint64
+}
+
+type uringCQOffsets struct {
+	head, tail, ringMask, ringEntries, overflow, cqes, flags, resv1 uint32
+	resv2                                                           uint64
+}
+
+type uringParams struct {
+	sqEntries, cqEntries, flags, sqThreadCPU, sqThreadIdle, features, wqFd uint32
+	resv                                                                   [3]uint32
+	sqOff                                                                  uringSQOffsets
+	cqOff                                                                  uringCQOffsets
+}
+
+type uringSQE struct {
+	opcode      uint8
+	flags       uint8
+	ioprio      uint16
+	fd          int32
+	off         uint64
+	addr        uint64
+	len         uint32
+	opFlags     uint32
+	userData    uint64
+	bufIndex    uint16
+	personality uint16
+	spliceFdIn  int32
+	pad         [2]uint64
+}
+
+type uringCQE struct {
+	userData uint64
+	res      int32
+	flags    uint32
+}
+
+type uring struct {
+	fd     int
+	params uringParams
+	sqRing []byte
+	cqRing []byte
+	sqes   []byte
+}
+
+// newUring sets up a ring of uringEntries, it fails on the kernels without
+// io_uring or when it's disabled, such as by the sysctl
+// kernel.io_uring_disabled or seccomp.
+func newUring() (*uring, error) {
+	r := new(uring)
+	fd, _, errno := unix.Syscall(unix.SYS_IO_URING_SETUP, uringEntries, uintptr(unsafe.Pointer(&r.params)), 0)
+	if errno != 0 {
+		return nil, errno
+	}
+	r.fd = int(fd)
+
+	var err error
+	p := &r.params
+	sqSize := int(p.sqOff.array + p.sqEntries*4)
+	if r.sqRing, err = unix.Mmap(r.fd, uringOffSQRing, sqSize, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED|unix.MAP_POPULATE); err != nil {
+		r.close()
+		return nil, err
+	}
+	cqSize := int(p.cqOff.cqes + p.cqEntries*uint32(unsafe.Sizeof(uringCQE{})))
+	if r.cqRing, err = unix.Mmap(r.fd, uringOffCQRing, cqSize, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED|unix.MAP_POPULATE); err != nil {
+		r.close()
+		return nil, err
+	}
+	sqesSize := int(p.sqEntries * uint32(unsafe.Sizeof(uringSQE{})))
+	if r.sqes, err = unix.Mmap(r.fd, uringOffSQEs, sqesSize, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED|unix.MAP_POPULATE); err != nil {
+		r.close()
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *uring) close() {
+	for _, m := range [][]byte{r.sqRing, r.cqRing, r.sqes} {
+		if m != nil {
+			unix.Munmap(m)
+		}
+	}
+	unix.Close(r.fd)
+}
+
+func ringUint32(ring []byte, off uint32) *uint32 {
+	return (*uint32)(unsafe.Pointer(&ring[off]))
+}
+
+// statx submits the statx of the paths, at most sqEntries, and waits for all
+// of them. res[i] is the result of paths[i], 0 or a negative errno.
+func (r *uring) statx(paths [][]byte, bufs []unix.Statx_t, res []int32) error {
+	p := &r.params
+	sqTail := ringUint32(r.sqRing, p.sqOff.tail)
+	sqMask := *ringUint32(r.sqRing, p.sqOff.ringMask)
+
+	tail := atomic.LoadUint32(sqTail)
+	for idx := range paths {
+		slot := (tail + uint32(idx)) & sqMask
+		sqe := (*uringSQE)(unsafe.Pointer(&r.sqes[uintptr(slot)*unsafe.Sizeof(uringSQE{})]))
+		*sqe = uringSQE{
+			opcode:   uringOpStatx,
+			fd:       unix.AT_FDCWD,
+			addr:     uint64(uintptr(unsafe.Pointer(&paths[idx][0]))),
+			len:      unix.STATX_TYPE | unix.STATX_MODE,
+			off:      uint64(uintptr(unsafe.Pointer(&bufs[idx]))),
+			userData: uint64(idx),
+		}
+		*ringUint32(r.sqRing, p.sqOff.array+slot*4) = slot
+	}
+	atomic.StoreUint32(sqTail, tail+uint32(len(paths)))
+
+	cqHead := ringUint32(r.cqRing, p.cqOff.head)
+	cqTail := ringUint32(r.cqRing, p.cqOff.tail)
+	cqMask := *ringUint32(r.cqRing, p.cqOff.ringMask)
+
+	submit, done := len(paths), 0
+	for done < len(paths) {
+		n, errno := retryEINTR(func() (uintptr, unix.Errno) {
+			n, _, errno := unix.Syscall6(unix.SYS_IO_URING_ENTER, uintptr(r.fd), uintptr(submit), 1, uringEnterGetEvents, 0, 0)
+			return n, errno
+		})
+		if errno != 0 {
+			return errno
+		}
+		submit -= int(n)
+
+		head := atomic.LoadUint32(cqHead)
+		for ; head != atomic.LoadUint32(cqTail); head++ {
+			off := p.cqOff.cqes + (head&cqMask)*uint32(unsafe.Sizeof(uringCQE{}))
+			cqe := (*uringCQE)(unsafe.Pointer(&r.cqRing[off]))
+			res[cqe.userData] = cqe.res
+			done++
+		}
+		atomic.StoreUint32(cqHead, head)
+	}
+
+	// the kernel is done with the paths and the buffers.
+	runtime.KeepAlive(paths)
+	runtime.KeepAlive(bufs)
+	return nil
+}
+
+// prestatFiles gets the modes of the files by statx through io_uring, many
+// in flight at once rather than one stat syscall per file. modes[i] is 0
+// when the statx of fnames[i] failed, then the file takes the usual path,
+// which reports the error as ever. it returns nil when io_uring isn't
+// available.
+func prestatFiles(fnames []string) []uint32 {
+	r, err := newUring()
+	if err != nil {
+		return nil
+	}
+	defer r.close()
+
+	var (
+		modes = make([]uint32, len(fnames))
+		bufs  = make([]unix.Statx_t, r.params.sqEntries)
+		res   = make([]int32, r.params.sqEntries)
+	)
+
+	for start := 0; start < len(fnames); start += int(r.params.sqEntries) {
+		end := start + int(r.params.sqEntries)
+		if end > len(fnames) {
+			end = len(fnames)
+		}
+
+		paths := make([][]byte, 0, end-start)
+		for _, fname := range fnames[start:end] {
+			paths = append(paths, append([]byte(fname), 0))
+		}
+		if err := r.statx(paths, bufs, res); err != nil {
+			return nil
+		}
+
+		for idx := range paths {
+			if res[idx] == 0 && bufs[idx].Mask&unix.STATX_TYPE != 0 {
+				modes[start+idx] = uint32(bufs[idx].Mode)
+			}
+		}
+	}
+	return modes
+}
+
+// checkStatxMode is checkFileMode of the mode from statx.
+func checkStatxMode(mode uint32) error {
+	switch mode & unix.S_IFMT {
+	case unix.S_IFDIR:
+		return ErrIsDirectory
+	case unix.S_IFREG, unix.S_IFBLK:
+		return nil
+	}
+	return ErrNotRegular
+}
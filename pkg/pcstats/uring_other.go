@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package pcstats
+
+// there is no io_uring, the batch always takes the usual path.
+func prestatFiles(fnames []string) []uint32 {
+	return nil
+}
+
+func checkStatxMode(mode uint32) error {
+	return nil
+}
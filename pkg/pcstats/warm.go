@@ -0,0 +1,47 @@
+package pcstats
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ErrMemoryLow is returned by WarmFile and WarmRange when the available
+// memory is already below WarmOptions.MinAvailable, nothing is loaded.
+var ErrMemoryLow = errors.New("available memory is below the minimum to warm")
+
+// WarmOptions bounds how much WarmFile and WarmRange load, so a bulk warm-up
+// of many relations doesn't evict the hot pages or trigger the oom killer.
+// the zero value means no limit.
+type WarmOptions struct {
+	// MinAvailable is the MemAvailable of /proc/meminfo in bytes to keep, at
+	// most the available memory beyond it is loaded.
+	MinAvailable int64
+
+	// Budget caps the bytes loaded by the call.
+	Budget int64
+}
+
+// parseMemAvailable finds the line such as `MemAvailable:   8012345 kB`.
+func parseMemAvailable(r io.Reader) (int64, error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "MemAvailable:" {
+			continue
+		}
+
+		kb, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("could not parse MemAvailable: %v", err)
+		}
+		return kb * 1024, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, errors.New("no MemAvailable in meminfo")
+}
@@ -0,0 +1,99 @@
+package pcstats
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// WarmFile loads the whole file into the page cache by readahead(2), it
+// returns the number of bytes asked the kernel to read in.
+func WarmFile(fname string, opts ...WarmOptions) (int64, error) {
+	return WarmRange(fname, 0, 0, opts...)
+}
+
+// WarmRange loads [offset, offset+length) of the file into the page cache,
+// a length of 0 means to the end of the file. with the limits of
+// WarmOptions, only the head of the range within them is loaded, the
+// returned bytes tell how much.
+func WarmRange(fname string, offset, length int64, opts ...WarmOptions) (int64, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return 0, fmt.Errorf("could not open file for read: %w", err)
+	}
+	defer f.Close()
+
+	size, err := getFileSize(f)
+	if err != nil {
+		return 0, err
+	}
+	if offset < 0 || length < 0 {
+		return 0, fmt.Errorf("invalid range, offset: %d, length: %d", offset, length)
+	}
+	if length == 0 || offset+length > size {
+		length = size - offset
+	}
+	if length <= 0 {
+		return 0, nil
+	}
+
+	var opt WarmOptions
+	if len(opts) != 0 {
+		opt = opts[0]
+	}
+	if length, err = opt.limit(length); err != nil {
+		return 0, err
+	}
+
+	// the kernel caps the pages read by a single readahead call, so
+	// issue it window by window to cover the whole range. readahead
+	// returns before the io is done, read the last byte of the window to
+	// wait for it, then the following GetPcStatus sees the pages cached.
+	var (
+		end = offset + length
+		buf = make([]byte, 1)
+	)
+	for off := offset; off < end; off += warmWindow {
+		count := min64(warmWindow, end-off)
+
+		if err := readahead(f, off, count); err != nil {
+			return off - offset, err
+		}
+		if _, err := f.ReadAt(buf, off+count-1); err != nil && err != io.EOF {
+			return off - offset, fmt.Errorf("could not read file: %v", err)
+		}
+	}
+	return length, nil
+}
+
+const warmWindow int64 = 2 * 1024 * 1024
+
+// limit caps the length to warm by the budget and the available memory.
+func (o WarmOptions) limit(length int64) (int64, error) {
+	if o.Budget > 0 && length > o.Budget {
+		length = o.Budget
+	}
+	if o.MinAvailable <= 0 {
+		return length, nil
+	}
+
+	available, err := getMemAvailable()
+	if err != nil {
+		return 0, err
+	}
+	if available-o.MinAvailable <= 0 {
+		return 0, ErrMemoryLow
+	}
+	return min64(length, available-o.MinAvailable), nil
+}
+
+// getMemAvailable returns MemAvailable of /proc/meminfo in bytes.
+func getMemAvailable() (int64, error) {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0, fmt.Errorf("could not open meminfo: %v", err)
+	}
+	defer f.Close()
+
+	return parseMemAvailable(f)
+}
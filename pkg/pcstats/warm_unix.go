@@ -0,0 +1,16 @@
+//go:build darwin || dragonfly || freebsd || netbsd || openbsd || solaris || windows
+// +build darwin dragonfly freebsd netbsd openbsd solaris windows
+
+package pcstats
+
+import "errors"
+
+var errWarmUnsupported = errors.New("readahead warming is only supported on linux")
+
+func WarmFile(fname string, opts ...WarmOptions) (int64, error) {
+	return 0, errWarmUnsupported
+}
+
+func WarmRange(fname string, offset, length int64, opts ...WarmOptions) (int64, error) {
+	return 0, errWarmUnsupported
+}
@@ -0,0 +1,105 @@
+package pcstats
+
+import (
+	"context"
+	"time"
+)
+
+// WatchPcStatus scans the files right away and then at every interval, and
+// sends the results to ch, the CachedDelta of every status is the change of
+// cached pages against the previous sample. the files with errors are left
+// out of the results. it closes ch and returns ctx.Err() once ctx is done.
+func WatchPcStatus(ctx context.Context, fnames []string, interval time.Duration, ch chan<- []PcStatus, opts BatchOptions) error {
+	files := make([]WatchFile, len(fnames))
+	for idx, fname := range fnames {
+		files[idx] = WatchFile{Key: fname, Name: fname}
+	}
+	resolve := func() ([]WatchFile, error) {
+		return files, nil
+	}
+	return WatchPcStatusFunc(ctx, resolve, interval, ch, opts)
+}
+
+// WatchFile is a file of WatchPcStatusFunc, Key identifies the file across
+// the samples while its Name may change, such as a segment of a relation
+// whose relfilenode is changed by VACUUM FULL or TRUNCATE.
+type WatchFile struct {
+	Key  string
+	Name string
+}
+
+// WatchResolver returns the files to scan at every sample, such as
+// pgutils.RelationResolver.
+type WatchResolver func() ([]WatchFile, error)
+
+// WatchPcStatusFunc is WatchPcStatus of the files returned by resolve at
+// every sample, the CachedDelta is against the previous sample of the same
+// Key, and the files whose Name changed since have Rewritten set. a sample
+// whose resolve fails scans the files of the previous one, the error of the
+// first resolve is returned as is.
+func WatchPcStatusFunc(ctx context.Context, resolve WatchResolver, interval time.Duration, ch chan<- []PcStatus, opts BatchOptions) error {
+	defer close(ch)
+
+	files, err := resolve()
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var (
+		logger    = opts.logger()
+		prev      = make(map[string]int, len(files))
+		prevNames = make(map[string]string, len(files))
+	)
+	for {
+		fnames := make([]string, len(files))
+		for idx, file := range files {
+			fnames[idx] = file.Name
+		}
+		stats, errs := GetPcStatusBatch(fnames, opts)
+
+		// the percent filter drops entries, so match them back by name.
+		keys := make(map[string]string, len(files))
+		for _, file := range files {
+			keys[file.Name] = file.Key
+		}
+
+		out := make([]PcStatus, 0, len(stats))
+		for idx, pcs := range stats {
+			if errs[idx] != nil {
+				continue
+			}
+
+			key := keys[pcs.Name]
+			if name, ok := prevNames[key]; ok && name != pcs.Name {
+				pcs.Rewritten = true
+				logger.Info("%s moved from %q to %q", key, name, pcs.Name)
+			}
+			if cached, ok := prev[key]; ok {
+				pcs.CachedDelta = pcs.Cached - cached
+			}
+			prev[key], prevNames[key] = pcs.Cached, pcs.Name
+			out = append(out, pcs)
+		}
+
+		select {
+		case ch <- out:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		if next, err := resolve(); err != nil {
+			logger.Warn("could not resolve the files to watch, rescan the previous ones: %v", err)
+		} else {
+			files = next
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package pcstats
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatchPcStatus(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := make(chan []PcStatus)
+	done := make(chan error, 1)
+
+	go func() {
+		done <- WatchPcStatus(ctx, []string{os.Args[0], "/not/exist"}, 10*time.Millisecond, ch, BatchOptions{})
+	}()
+
+	for i := 0; i < 2; i++ {
+		stats := <-ch
+		assert.Equal(t, 1, len(stats))
+		assert.Equal(t, os.Args[0], stats[0].Name)
+	}
+
+	cancel()
+	for range ch {
+	}
+	assert.Equal(t, context.Canceled, <-done)
+}
+
+func TestWatchPcStatusFunc(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pgcacher-watch")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	before, after := filepath.Join(dir, "16384"), filepath.Join(dir, "16390")
+	for _, fname := range []string{before, after} {
+		assert.Nil(t, ioutil.WriteFile(fname, make([]byte, 4096), 0644))
+	}
+
+	// the relation is rewritten into a new relfilenode after the first sample.
+	var samples int
+	resolve := func() ([]WatchFile, error) {
+		samples++
+		if samples == 1 {
+			return []WatchFile{{Key: "public.orders", Name: before}}, nil
+		}
+		return []WatchFile{{Key: "public.orders", Name: after}}, nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := make(chan []PcStatus)
+	done := make(chan error, 1)
+	go func() {
+		done <- WatchPcStatusFunc(ctx, resolve, 10*time.Millisecond, ch, BatchOptions{})
+	}()
+
+	stats := <-ch
+	assert.Equal(t, before, stats[0].Name)
+	assert.False(t, stats[0].Rewritten)
+
+	stats = <-ch
+	assert.Equal(t, after, stats[0].Name)
+	assert.True(t, stats[0].Rewritten)
+
+	stats = <-ch
+	assert.Equal(t, after, stats[0].Name)
+	assert.False(t, stats[0].Rewritten)
+
+	cancel()
+	for range ch {
+	}
+	assert.Equal(t, context.Canceled, <-done)
+}
@@ -0,0 +1,159 @@
+package pgutils
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+
+	"github.com/rfyiamcool/pgcacher/pkg/pcstats"
+)
+
+// BufferOverlap is the double buffering of a fork of a relation, the shared
+// buffers of it which are also in the page cache.
+type BufferOverlap struct {
+	Relation       string `json:"relation"`
+	Fork           Role   `json:"fork"`
+	Buffered       int    `json:"buffered"`        // blocks in shared_buffers
+	DoubleBuffered int    `json:"double_buffered"` // blocks in both shared_buffers and the page cache
+	Error          string `json:"error,omitempty"` // why the files of the fork can't be checked, "" on success
+}
+
+// bufferKey is a fork of a relation with blocks in shared_buffers.
+type bufferKey struct {
+	relname, relpath string
+	fork             int
+}
+
+// bufferCacheQuery lists the blocks in shared_buffers of the relations of
+// the connected database, including the shared catalogs.
+const bufferCacheQuery = `
+SELECT c.oid::regclass::text, pg_relation_filepath(c.oid), b.relforknumber, b.relblocknumber
+FROM pg_buffercache b
+JOIN pg_class c ON b.relfilenode = pg_relation_filenode(c.oid)
+WHERE b.reldatabase IN (0, (SELECT oid FROM pg_database WHERE datname = current_database()))
+  AND pg_relation_filepath(c.oid) IS NOT NULL`
+
+// DoubleBuffered cross-references the blocks in shared_buffers from the
+// pg_buffercache extension with the mincore residency of the relation
+// files, and reports the blocks cached twice for every fork of the relations
+// of the connected database, sorted by relation and fork. it needs the
+// pg_buffercache extension and the files readable by the caller. a fork
+// whose files can't be scanned, such as a segment removed by a concurrent
+// TRUNCATE, has its Error set rather than failing the others.
+func DoubleBuffered(conn *sql.DB) ([]BufferOverlap, error) {
+	dirs, err := DiscoverDataDirs(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	blockSize, segBlocks, err := storageSettings(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := conn.Query(bufferCacheQuery)
+	if err != nil {
+		return nil, fmt.Errorf("could not query pg_buffercache: %v", err)
+	}
+	defer rows.Close()
+
+	blocks := make(map[bufferKey][]int64)
+	for rows.Next() {
+		var (
+			key   bufferKey
+			block int64
+		)
+		if err := rows.Scan(&key.relname, &key.relpath, &key.fork, &block); err != nil {
+			return nil, fmt.Errorf("could not query pg_buffercache: %v", err)
+		}
+		if key.fork < 0 || key.fork >= len(Forks) {
+			continue
+		}
+		blocks[key] = append(blocks[key], block)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not query pg_buffercache: %v", err)
+	}
+
+	return bufferOverlaps(dirs, blocks, blockSize, segBlocks), nil
+}
+
+// bufferOverlaps checks the buffered blocks of every fork against the page
+// cache of its files.
+func bufferOverlaps(dirs map[Oid]string, blocks map[bufferKey][]int64, blockSize int, segBlocks int64) []BufferOverlap {
+	overlaps := make([]BufferOverlap, 0, len(blocks))
+	for key, kblocks := range blocks {
+		suffix := Forks[key.fork]
+		base := relationFullPath(dirs, key.relpath) + suffix
+
+		ov := BufferOverlap{
+			Relation: key.relname,
+			Fork:     forkRoles[suffix],
+			Buffered: len(kblocks),
+		}
+		double, err := countDoubleBuffered(base, kblocks, blockSize, segBlocks)
+		if err != nil {
+			ov.Error = fmt.Sprintf("could not check relation %q: %v", key.relname, err)
+		} else {
+			ov.DoubleBuffered = double
+		}
+		overlaps = append(overlaps, ov)
+	}
+
+	sort.Slice(overlaps, func(i, j int) bool {
+		if overlaps[i].Relation != overlaps[j].Relation {
+			return overlaps[i].Relation < overlaps[j].Relation
+		}
+		return overlaps[i].Fork < overlaps[j].Fork
+	})
+	return overlaps
+}
+
+// storageSettings returns the block size in bytes and the segment size in
+// blocks of the server.
+func storageSettings(conn *sql.DB) (int, int64, error) {
+	var (
+		blockSize int
+		segBlocks int64
+	)
+	err := conn.QueryRow(
+		"SELECT current_setting('block_size')::int, (SELECT setting::bigint FROM pg_settings WHERE name = 'segment_size')",
+	).Scan(&blockSize, &segBlocks)
+	if err != nil {
+		return 0, 0, fmt.Errorf("could not get block_size and segment_size: %v", err)
+	}
+	return blockSize, segBlocks, nil
+}
+
+// countDoubleBuffered counts the blocks which are cached in the segment
+// files of the fork whose first segment is base, the bitmap of every
+// segment is only fetched once.
+func countDoubleBuffered(base string, blocks []int64, blockSize int, segBlocks int64) (int, error) {
+	var (
+		bitmaps = make(map[int64][]bool)
+		double  int
+	)
+	for _, block := range blocks {
+		seg := block / segBlocks
+
+		bitmap, ok := bitmaps[seg]
+		if !ok {
+			fname := base
+			if seg > 0 {
+				fname = fmt.Sprintf("%s.%d", base, seg)
+			}
+
+			var err error
+			_, bitmap, err = pcstats.GetPcStatusWithBitmap(fname, nil, pcstats.Options{PageSize: blockSize})
+			if err != nil {
+				return 0, err
+			}
+			bitmaps[seg] = bitmap
+		}
+
+		if idx := block % segBlocks; idx < int64(len(bitmap)) && bitmap[idx] {
+			double++
+		}
+	}
+	return double, nil
+}
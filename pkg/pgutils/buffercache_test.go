@@ -0,0 +1,52 @@
+package pgutils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCountDoubleBuffered(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pgcacher")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	// two segments of 4 and 2 blocks, all cached as they were just written.
+	base := filepath.Join(dir, "16384")
+	assert.Nil(t, ioutil.WriteFile(base, make([]byte, 4*8192), 0644))
+	assert.Nil(t, ioutil.WriteFile(base+".1", make([]byte, 2*8192), 0644))
+
+	double, err := countDoubleBuffered(base, []int64{0, 3, 5, 7}, 8192, 4)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, double)
+
+	_, err = countDoubleBuffered(base, []int64{9}, 8192, 4)
+	assert.NotNil(t, err)
+}
+
+func TestBufferOverlaps(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pgcacher")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	db := filepath.Join(dir, "base", "5")
+	assert.Nil(t, os.MkdirAll(db, 0755))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(db, "16384"), make([]byte, 4*8192), 0644))
+	dirs := map[Oid]string{DefaultTablespace: filepath.Join(dir, "base")}
+
+	// the second relation lost its files, such as by a concurrent TRUNCATE.
+	overlaps := bufferOverlaps(dirs, map[bufferKey][]int64{
+		{relname: "public.orders", relpath: "base/5/16384"}:          {0, 1},
+		{relname: "public.gone", relpath: "base/5/16390"}:            {0},
+		{relname: "public.orders", relpath: "base/5/16384", fork: 1}: {0},
+	}, 8192, 4)
+	assert.Equal(t, 3, len(overlaps))
+	assert.Equal(t, "public.gone", overlaps[0].Relation)
+	assert.NotEqual(t, "", overlaps[0].Error)
+	assert.Equal(t, BufferOverlap{Relation: "public.orders", Fork: RoleMain, Buffered: 2, DoubleBuffered: 2}, overlaps[2])
+	assert.Equal(t, RoleFSM, overlaps[1].Fork)
+	assert.NotEqual(t, "", overlaps[1].Error)
+}
@@ -0,0 +1,206 @@
+package pgutils
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DefaultSocketDirs are the common unix_socket_directories of postgresql.
+var DefaultSocketDirs = []string{"/var/run/postgresql", "/tmp"}
+
+// ConnOptions are the params to connect to postgresql, the empty ones fall
+// back to the PGHOST, PGPORT, PGUSER, PGPASSWORD, PGDATABASE, PGSSLMODE,
+// PGSSLROOTCERT, PGSSLCERT and PGSSLKEY env like libpq does.
+type ConnOptions struct {
+	Host     string
+	Port     string
+	User     string
+	Password string
+	Database string
+
+	// SSLMode is the sslmode of libpq, such as require and verify-full,
+	// the certs and the key are the paths of the pem files. they only apply
+	// to tcp, the unix sockets are never over tls, as libpq.
+	SSLMode     string
+	SSLRootCert string
+	SSLCert     string
+	SSLKey      string
+}
+
+// SSLModes are the sslmode values of libpq.
+var SSLModes = []string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}
+
+func (o ConnOptions) withEnv() ConnOptions {
+	o.Host = firstNonEmpty(o.Host, os.Getenv("PGHOST"))
+	o.Port = firstNonEmpty(o.Port, os.Getenv("PGPORT"), "5432")
+	o.User = firstNonEmpty(o.User, os.Getenv("PGUSER"))
+	o.Password = firstNonEmpty(o.Password, os.Getenv("PGPASSWORD"))
+	o.Database = firstNonEmpty(o.Database, os.Getenv("PGDATABASE"))
+	o.SSLMode = firstNonEmpty(o.SSLMode, os.Getenv("PGSSLMODE"))
+	o.SSLRootCert = firstNonEmpty(o.SSLRootCert, os.Getenv("PGSSLROOTCERT"))
+	o.SSLCert = firstNonEmpty(o.SSLCert, os.Getenv("PGSSLCERT"))
+	o.SSLKey = firstNonEmpty(o.SSLKey, os.Getenv("PGSSLKEY"))
+	return o
+}
+
+// Validate checks the sslmode is one of SSLModes, and the certs and the key
+// it needs are set, so a typo doesn't silently fall back to plaintext.
+func (o ConnOptions) Validate() error {
+	o = o.withEnv()
+	if o.SSLMode == "" {
+		return nil
+	}
+
+	valid := false
+	for _, mode := range SSLModes {
+		if o.SSLMode == mode {
+			valid = true
+		}
+	}
+	if !valid {
+		return fmt.Errorf("invalid sslmode %q, should be one of %s", o.SSLMode, strings.Join(SSLModes, ", "))
+	}
+	if (o.SSLCert == "") != (o.SSLKey == "") {
+		return errors.New("sslcert and sslkey should be set together")
+	}
+	return nil
+}
+
+// Hosts returns the hosts to try in order, the host of the options if it's
+// set, otherwise the socket dirs holding the socket of the port, then
+// localhost over tcp.
+func (o ConnOptions) Hosts() []string {
+	o = o.withEnv()
+	if o.Host != "" {
+		return []string{o.Host}
+	}
+
+	var hosts []string
+	for _, dir := range DefaultSocketDirs {
+		sock := filepath.Join(dir, ".s.PGSQL."+o.Port)
+		if _, err := os.Stat(sock); err == nil {
+			hosts = append(hosts, dir)
+		}
+	}
+	return append(hosts, "localhost")
+}
+
+// DSN returns the key=value connection string to the host.
+func (o ConnOptions) DSN(host string) string {
+	o = o.withEnv()
+
+	params := map[string]string{
+		"host":     host,
+		"port":     o.Port,
+		"user":     o.User,
+		"password": o.Password,
+		"dbname":   o.Database,
+	}
+	if !strings.HasPrefix(host, "/") {
+		params["sslmode"] = o.SSLMode
+		params["sslrootcert"] = o.SSLRootCert
+		params["sslcert"] = o.SSLCert
+		params["sslkey"] = o.SSLKey
+	}
+	return formatDSN(params)
+}
+
+// Connect connects to postgresql by the driver, it tries the local unix
+// socket first and falls back to tcp localhost, returns the first
+// connection which is pinged ok.
+func Connect(driverName string, opts ConnOptions) (*sql.DB, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	var errs []string
+	for _, host := range opts.Hosts() {
+		conn, err := sql.Open(driverName, opts.DSN(host))
+		if err == nil {
+			err = conn.Ping()
+			if err == nil {
+				return conn, nil
+			}
+			conn.Close()
+		}
+		errs = append(errs, fmt.Sprintf("%s: %v", host, err))
+	}
+
+	return nil, errors.New("could not connect to postgresql, " + strings.Join(errs, ", "))
+}
+
+// WithSSL sets the ssl params of the options which are set to the dsn, they
+// override the ones of the dsn. for a key=value dsn they are appended, lib/pq
+// takes the last of the duplicate keys, for a postgres:// url they are set
+// in the query.
+func WithSSL(dsn string, opts ConnOptions) string {
+	params := map[string]string{
+		"sslmode":     opts.SSLMode,
+		"sslrootcert": opts.SSLRootCert,
+		"sslcert":     opts.SSLCert,
+		"sslkey":      opts.SSLKey,
+	}
+
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return dsn
+		}
+		query := u.Query()
+		for key, value := range params {
+			if value != "" {
+				query.Set(key, value)
+			}
+		}
+		u.RawQuery = query.Encode()
+		return u.String()
+	}
+
+	if ssl := formatDSN(params); ssl != "" {
+		return strings.TrimSpace(dsn + " " + ssl)
+	}
+	return dsn
+}
+
+// formatDSN formats the non-empty params as `key=value`, the values are
+// quoted as libpq needs.
+func formatDSN(params map[string]string) string {
+	keys := make([]string, 0, len(params))
+	for key, value := range params {
+		if value != "" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		parts = append(parts, key+"="+quoteDSNValue(params[key]))
+	}
+	return strings.Join(parts, " ")
+}
+
+func quoteDSNValue(value string) string {
+	if !strings.ContainsAny(value, ` '\`) {
+		return value
+	}
+
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `'`, `\'`)
+	return "'" + value + "'"
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,46 @@
+package pgutils
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConnOptions(t *testing.T) {
+	os.Setenv("PGUSER", "postgres")
+	os.Setenv("PGPORT", "5433")
+	defer os.Unsetenv("PGUSER")
+	defer os.Unsetenv("PGPORT")
+
+	opts := ConnOptions{Host: "db", Database: "app", Password: "it's secret"}
+	assert.Equal(t, []string{"db"}, opts.Hosts())
+	assert.Equal(t, `dbname=app host=db password='it\'s secret' port=5433 user=postgres`, opts.DSN("db"))
+
+	hosts := ConnOptions{}.Hosts()
+	assert.Equal(t, "localhost", hosts[len(hosts)-1])
+}
+
+func TestConnOptionsSSL(t *testing.T) {
+	os.Setenv("PGSSLMODE", "verify-full")
+	defer os.Unsetenv("PGSSLMODE")
+
+	opts := ConnOptions{Host: "db.example.com", Port: "5432", SSLRootCert: "/etc/ssl/root.pem"}
+	assert.Nil(t, opts.Validate())
+	assert.Equal(t, "host=db.example.com port=5432 sslmode=verify-full sslrootcert=/etc/ssl/root.pem", opts.DSN("db.example.com"))
+
+	// the unix sockets are never over tls.
+	assert.Equal(t, "host=/var/run/postgresql port=5432", opts.DSN("/var/run/postgresql"))
+
+	assert.NotNil(t, ConnOptions{SSLMode: "verify_full"}.Validate())
+	assert.NotNil(t, ConnOptions{SSLMode: "require", SSLCert: "client.pem"}.Validate())
+	assert.Nil(t, ConnOptions{SSLMode: "require", SSLCert: "client.pem", SSLKey: "client.key"}.Validate())
+}
+
+func TestWithSSL(t *testing.T) {
+	assert.Equal(t, "host=db", WithSSL("host=db", ConnOptions{}))
+	assert.Equal(t, "host=db sslmode=disable sslmode=verify-full sslrootcert='/etc/my ca.pem'",
+		WithSSL("host=db sslmode=disable", ConnOptions{SSLMode: "verify-full", SSLRootCert: "/etc/my ca.pem"}))
+	assert.Equal(t, "postgres://u@db:5432/app?sslmode=verify-full",
+		WithSSL("postgres://u@db:5432/app?sslmode=disable", ConnOptions{SSLMode: "verify-full"}))
+}
@@ -0,0 +1,69 @@
+package pgutils
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// DatabaseOf returns the oid of the database that the relation file
+// belongs to, by its `base/<dboid>/` or `pg_tblspc/<spcoid>/<version>/<dboid>/`
+// dir. the shared relations of `global/` and other files have no database.
+func DatabaseOf(path string) (Oid, bool) {
+	if !IsRelationFile(path) {
+		return 0, false
+	}
+
+	parts := strings.Split(filepath.ToSlash(filepath.Clean(path)), "/")
+	if parts[len(parts)-2] == "global" {
+		return 0, false
+	}
+
+	oid, err := strconv.ParseUint(parts[len(parts)-2], 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	return Oid(oid), true
+}
+
+// DatabaseNames returns the names of all the databases keyed by their oid.
+func DatabaseNames(conn *sql.DB) (map[Oid]string, error) {
+	rows, err := conn.Query("SELECT oid, datname FROM pg_database")
+	if err != nil {
+		return nil, fmt.Errorf("could not get databases: %v", err)
+	}
+	defer rows.Close()
+
+	names := make(map[Oid]string)
+	for rows.Next() {
+		var (
+			oid  Oid
+			name string
+		)
+		if err := rows.Scan(&oid, &name); err != nil {
+			return nil, fmt.Errorf("could not get databases: %v", err)
+		}
+		names[oid] = name
+	}
+
+	return names, rows.Err()
+}
+
+// DatabaseMapper returns the fileToDB of pcstats.GroupByDatabase, which maps
+// the file to the name of its database in names, or to the oid when the
+// name is unknown, such as with a nil names. the files without a database
+// are mapped to "".
+func DatabaseMapper(names map[Oid]string) func(string) string {
+	return func(path string) string {
+		oid, ok := DatabaseOf(path)
+		if !ok {
+			return ""
+		}
+		if name, ok := names[oid]; ok {
+			return name
+		}
+		return strconv.FormatUint(uint64(oid), 10)
+	}
+}
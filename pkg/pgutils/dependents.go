@@ -0,0 +1,114 @@
+package pgutils
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Role is the role of a file in a table.
+type Role string
+
+const (
+	RoleMain       Role = "main"
+	RoleFSM        Role = "fsm"
+	RoleVM         Role = "vm"
+	RoleInit       Role = "init"
+	RoleToast      Role = "toast"
+	RoleToastIndex Role = "toast_index"
+	RoleIndex      Role = "index"
+)
+
+// forkRoles maps the fork suffixes to the roles of the table itself.
+var forkRoles = map[string]Role{
+	"":      RoleMain,
+	"_fsm":  RoleFSM,
+	"_vm":   RoleVM,
+	"_init": RoleInit,
+}
+
+// ResolveRelationWithDependents is the same as ResolveRelationFiles, but
+// also resolves the files of all the indexes of the table, its TOAST table
+// and the TOAST index, as they compete for the same page cache. the files
+// are grouped by role so the cache usage can be attributed, the files of
+// indexes and TOAST include all their forks.
+func ResolveRelationWithDependents(conn *sql.DB, dbname, relname string) (map[Role][]string, error) {
+	if err := checkDatabase(conn, dbname); err != nil {
+		return nil, err
+	}
+
+	dirs, err := DiscoverDataDirs(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	relpath, err := relationFilepath(conn, relname)
+	if err != nil {
+		return nil, err
+	}
+
+	dependents := []struct {
+		role  Role
+		query string
+	}{
+		{RoleIndex, "SELECT pg_relation_filepath(i.indexrelid) FROM pg_index i WHERE i.indrelid = to_regclass($1)"},
+		{RoleToast, "SELECT pg_relation_filepath(c.reltoastrelid) FROM pg_class c WHERE c.oid = to_regclass($1) AND c.reltoastrelid <> 0"},
+		{RoleToastIndex, `SELECT pg_relation_filepath(i.indexrelid) FROM pg_index i
+			JOIN pg_class c ON i.indrelid = c.reltoastrelid
+			WHERE c.oid = to_regclass($1) AND c.reltoastrelid <> 0`},
+	}
+	relpaths := make(map[Role][]string, len(dependents))
+	for _, dep := range dependents {
+		paths, err := queryFilepaths(conn, dep.query, relname)
+		if err != nil {
+			return nil, fmt.Errorf("could not resolve %s of relation %q: %v", dep.role, relname, err)
+		}
+		relpaths[dep.role] = paths
+	}
+
+	return dependentFiles(dirs, relpath, relpaths), nil
+}
+
+// dependentFiles groups the existing files by role, the forks of the table
+// whose main fork is at relpath by forkRoles, and all the forks and
+// segments of the dependents of relpaths under their role. the roles
+// without files are left out.
+func dependentFiles(dirs map[Oid]string, relpath string, relpaths map[Role][]string) map[Role][]string {
+	files := make(map[Role][]string)
+	base := relationFullPath(dirs, relpath)
+	for _, fork := range Forks {
+		if segs := forkSegments(base + fork); len(segs) != 0 {
+			files[forkRoles[fork]] = segs
+		}
+	}
+
+	for _, role := range []Role{RoleIndex, RoleToast, RoleToastIndex} {
+		for _, relpath := range relpaths[role] {
+			if segs := RelationSegments(relationFullPath(dirs, relpath)); len(segs) != 0 {
+				files[role] = append(files[role], segs...)
+			}
+		}
+	}
+	return files
+}
+
+// queryFilepaths returns the non-null paths of the first column.
+func queryFilepaths(conn *sql.DB, query string, args ...interface{}) ([]string, error) {
+	rows, err := conn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var relpaths []string
+	for rows.Next() {
+		var relpath sql.NullString
+		if err := rows.Scan(&relpath); err != nil {
+			return nil, err
+		}
+		if relpath.Valid {
+			relpaths = append(relpaths, relpath.String)
+		}
+	}
+
+	return relpaths, rows.Err()
+}
@@ -0,0 +1,54 @@
+package pgutils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDependentFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pgcacher")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	db := filepath.Join(dir, "base", "5")
+	assert.Nil(t, os.MkdirAll(db, 0755))
+	for _, name := range []string{
+		"16384", "16384.1", "16384_fsm", "16384_vm", // the table
+		"16387", "16387_fsm", // its toast
+		"16389",            // the toast index
+		"16390", "16390.1", // an index
+		"16391", // another index
+	} {
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(db, name), nil, 0644))
+	}
+	dirs := map[Oid]string{DefaultTablespace: filepath.Join(dir, "base")}
+
+	files := dependentFiles(dirs, "base/5/16384", map[Role][]string{
+		RoleIndex:      {"base/5/16390", "base/5/16391", "base/5/16392"},
+		RoleToast:      {"base/5/16387"},
+		RoleToastIndex: {"base/5/16389"},
+	})
+	path := func(names ...string) []string {
+		var paths []string
+		for _, name := range names {
+			paths = append(paths, filepath.Join(db, name))
+		}
+		return paths
+	}
+	assert.Equal(t, map[Role][]string{
+		RoleMain:       path("16384", "16384.1"),
+		RoleFSM:        path("16384_fsm"),
+		RoleVM:         path("16384_vm"),
+		RoleToast:      path("16387", "16387_fsm"),
+		RoleToastIndex: path("16389"),
+		RoleIndex:      path("16390", "16390.1", "16391"),
+	}, files)
+
+	// a table without toast nor indexes only has its forks.
+	files = dependentFiles(dirs, "base/5/16391", nil)
+	assert.Equal(t, map[Role][]string{RoleMain: path("16391")}, files)
+}
@@ -0,0 +1,58 @@
+package pgutils
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/rfyiamcool/pgcacher/pkg/pcstats"
+)
+
+// DirectIO is which files the server reads and writes with O_DIRECT by the
+// debug_io_direct setting of postgresql 16+, their blocks bypass the page
+// cache, so they are legitimately uncached. io_method of postgresql 18 only
+// changes how the io is issued, it doesn't bypass the page cache.
+type DirectIO struct {
+	Data bool // the relation files
+	WAL  bool // the wal segments, by wal
+}
+
+// DirectIOSettings returns the DirectIO of the server, none before
+// postgresql 16, which has no debug_io_direct.
+func DirectIOSettings(conn *sql.DB) (DirectIO, error) {
+	var setting sql.NullString
+	if err := conn.QueryRow("SELECT current_setting('debug_io_direct', true)").Scan(&setting); err != nil {
+		return DirectIO{}, fmt.Errorf("could not get debug_io_direct: %v", err)
+	}
+	return parseDirectIO(setting.String), nil
+}
+
+// parseDirectIO parses the list of debug_io_direct, such as `data, wal`.
+// wal_init only zero-fills the new wal segments with O_DIRECT, they are read
+// and written through the page cache afterwards, so it doesn't set WAL.
+func parseDirectIO(setting string) DirectIO {
+	var dio DirectIO
+	for _, item := range strings.Split(setting, ",") {
+		switch strings.ToLower(strings.TrimSpace(item)) {
+		case "data":
+			dio.Data = true
+		case "wal":
+			dio.WAL = true
+		}
+	}
+	return dio
+}
+
+// AnnotateDirectIO sets the DirectIO of the statuses of the relation files
+// and the wal segments read with O_DIRECT by dio, so their 0% cached isn't
+// taken for a cold cache.
+func AnnotateDirectIO(statuses []pcstats.PcStatus, dio DirectIO) {
+	for idx := range statuses {
+		switch name := statuses[idx].Name; {
+		case IsRelationFile(name):
+			statuses[idx].DirectIO = dio.Data
+		case pcstats.IsWALFile(name):
+			statuses[idx].DirectIO = dio.WAL
+		}
+	}
+}
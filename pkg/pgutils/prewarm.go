@@ -0,0 +1,65 @@
+package pgutils
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/rfyiamcool/pgcacher/pkg/pcstats"
+)
+
+// PrewarmRelation loads the main fork of the relation, such as
+// `public.orders`, into shared_buffers by pg_prewarm(rel, 'buffer'), unlike
+// pcstats.WarmFile which only loads the page cache. the blocks are read by
+// the server, so it needs the pg_prewarm extension in the connected
+// database but no access to the files. a relation larger than
+// shared_buffers only keeps its last blocks buffered.
+func PrewarmRelation(conn *sql.DB, relname string) error {
+	_, err := prewarm(conn, relname)
+	return err
+}
+
+// PrewarmAndScan is PrewarmRelation followed by the scan of the files of the
+// main fork, to confirm the blocks read through the server are in the page
+// cache too. it needs the files readable by the caller as
+// ResolveRelationFiles.
+func PrewarmAndScan(conn *sql.DB, relname string) ([]pcstats.PcStatus, error) {
+	if _, err := prewarm(conn, relname); err != nil {
+		return nil, err
+	}
+
+	files, err := ResolveRelationFiles(conn, "", relname)
+	if err != nil {
+		return nil, err
+	}
+	var mains []string
+	for _, fname := range files {
+		if pcstats.RelationFork(fname) == pcstats.ForkMain {
+			mains = append(mains, fname)
+		}
+	}
+
+	stats, errs := pcstats.GetPcStatusBatch(mains, pcstats.BatchOptions{})
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return stats, nil
+}
+
+// prewarm returns the number of blocks loaded by pg_prewarm.
+func prewarm(conn *sql.DB, relname string) (int64, error) {
+	var blocks int64
+	err := conn.QueryRow(
+		"SELECT pg_prewarm(c.oid, 'buffer') FROM pg_class c WHERE c.oid = to_regclass($1)",
+		relname,
+	).Scan(&blocks)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("relation %q not found", relname)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("could not prewarm relation %q, is the pg_prewarm extension created: %v", relname, err)
+	}
+	return blocks, nil
+}
@@ -0,0 +1,115 @@
+// pgutils resolves postgresql relations to their files on disk.
+//
+// the functions take a *sql.DB, so any postgresql driver of database/sql
+// can be used, such as github.com/lib/pq or github.com/jackc/pgx/v4/stdlib.
+package pgutils
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Forks are the suffixes of the fork files of a relation, the main fork
+// has no suffix.
+var Forks = []string{"", "_fsm", "_vm", "_init"}
+
+// ResolveRelationFiles returns the full paths of all the segment files of
+// all the forks of the relation, such as `public.orders`. postgresql can
+// only resolve the relations of the connected database, so conn must be
+// connected to dbname, an empty dbname means the connected one.
+//
+// pg_relation_filepath follows the relfilenode, so the files are found even
+// if the table has been rewritten by VACUUM FULL or TRUNCATE.
+func ResolveRelationFiles(conn *sql.DB, dbname, relname string) ([]string, error) {
+	if err := checkDatabase(conn, dbname); err != nil {
+		return nil, err
+	}
+
+	dirs, err := DiscoverDataDirs(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	relpath, err := relationFilepath(conn, relname)
+	if err != nil {
+		return nil, err
+	}
+
+	return RelationSegments(relationFullPath(dirs, relpath)), nil
+}
+
+// DataDirectory returns the data directory of the server, it needs the
+// superuser or pg_read_all_settings role.
+func DataDirectory(conn *sql.DB) (string, error) {
+	var dir string
+	if err := conn.QueryRow("SHOW data_directory").Scan(&dir); err != nil {
+		return "", fmt.Errorf("could not get data_directory: %v", err)
+	}
+	return dir, nil
+}
+
+// RelationSegments returns the existing segment files of all the forks of
+// the relation whose main fork file is base, such as `base/5/16384`,
+// `base/5/16384.1`, `base/5/16384_fsm`.
+func RelationSegments(base string) []string {
+	var files []string
+	for _, fork := range Forks {
+		files = append(files, forkSegments(base+fork)...)
+	}
+	return files
+}
+
+// forkSegments returns fname, fname.1, fname.2 ... until the one missing.
+func forkSegments(fname string) []string {
+	var files []string
+	for seg := 0; ; seg++ {
+		segname := fname
+		if seg > 0 {
+			segname = fmt.Sprintf("%s.%d", fname, seg)
+		}
+
+		if _, err := os.Stat(segname); err != nil {
+			return files
+		}
+		files = append(files, segname)
+	}
+}
+
+func checkDatabase(conn *sql.DB, dbname string) error {
+	if dbname == "" {
+		return nil
+	}
+
+	var current string
+	if err := conn.QueryRow("SELECT current_database()").Scan(&current); err != nil {
+		return fmt.Errorf("could not get current database: %v", err)
+	}
+	if current != dbname {
+		return fmt.Errorf("connected to database %q, not %q", current, dbname)
+	}
+	return nil
+}
+
+// relationFilepath returns the path of the main fork relative to the data
+// directory, such as `base/5/16384`.
+func relationFilepath(conn *sql.DB, relname string) (string, error) {
+	var relpath sql.NullString
+	err := conn.QueryRow(
+		"SELECT pg_relation_filepath(c.oid) FROM pg_class c WHERE c.oid = to_regclass($1)",
+		relname,
+	).Scan(&relpath)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("relation %q not found", relname)
+	}
+	if err != nil {
+		return "", fmt.Errorf("could not resolve relation %q: %v", relname, err)
+	}
+	if !relpath.Valid {
+		// views and other relations without storage.
+		return "", fmt.Errorf("relation %q has no files", relname)
+	}
+
+	return relpath.String, nil
+}
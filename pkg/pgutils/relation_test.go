@@ -0,0 +1,91 @@
+package pgutils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rfyiamcool/pgcacher/pkg/pcstats"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRelationSegments(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pgcacher")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"16384", "16384.1", "16384.3", "16384_fsm", "16384_vm", "16385"} {
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, name), nil, 0644))
+	}
+
+	files := RelationSegments(filepath.Join(dir, "16384"))
+	assert.Equal(t, []string{
+		filepath.Join(dir, "16384"),
+		filepath.Join(dir, "16384.1"),
+		filepath.Join(dir, "16384_fsm"),
+		filepath.Join(dir, "16384_vm"),
+	}, files)
+}
+
+func TestRelationFullPath(t *testing.T) {
+	dirs := map[Oid]string{
+		DefaultTablespace: "/pgdata/base",
+		GlobalTablespace:  "/pgdata/global",
+		16500:             "/mnt/ts1",
+	}
+
+	assert.Equal(t, "/pgdata/base/5/16384", relationFullPath(dirs, "base/5/16384"))
+	assert.Equal(t, "/pgdata/global/1262", relationFullPath(dirs, "global/1262"))
+	assert.Equal(t, "/mnt/ts1/PG_15_202209061/5/16390", relationFullPath(dirs, "pg_tblspc/16500/PG_15_202209061/5/16390"))
+	assert.Equal(t, "/pgdata/pg_tblspc/16501/PG_15_202209061/5/16390", relationFullPath(dirs, "pg_tblspc/16501/PG_15_202209061/5/16390"))
+}
+
+func TestResolveTablespace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pgcacher")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	volume := filepath.Join(dir, "volume")
+	for _, sub := range []string{"PG_15_202209061/5", "PG_15_202209061/16384", "PG_15_202209061/pgsql_tmp"} {
+		assert.Nil(t, os.MkdirAll(filepath.Join(volume, sub), 0755))
+	}
+	assert.Nil(t, os.MkdirAll(filepath.Join(dir, "pg_tblspc"), 0755))
+	entry := filepath.Join(dir, "pg_tblspc", "16500")
+	assert.Nil(t, os.Symlink(volume, entry))
+
+	ts, err := ResolveTablespace(entry, "")
+	assert.Nil(t, err)
+	assert.Equal(t, Oid(16500), ts.Oid)
+	assert.Equal(t, "PG_15_202209061", ts.VersionDir)
+	assert.Equal(t, map[Oid]string{
+		5:     filepath.Join(volume, "PG_15_202209061", "5"),
+		16384: filepath.Join(volume, "PG_15_202209061", "16384"),
+	}, ts.Databases)
+
+	// the old version dir is left by pg_upgrade.
+	assert.Nil(t, os.MkdirAll(filepath.Join(volume, "PG_14_202107181"), 0755))
+	_, err = ResolveTablespace(entry, "")
+	assert.NotNil(t, err)
+
+	ts, err = ResolveTablespace(entry, "PG_15_202209061")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(ts.Databases))
+}
+
+func TestWatchFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pgcacher")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"16390", "16390.1", "16390_fsm"} {
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, name), nil, 0644))
+	}
+
+	files := watchFiles("public.orders", filepath.Join(dir, "16390"))
+	assert.Equal(t, []pcstats.WatchFile{
+		{Key: "public.orders", Name: filepath.Join(dir, "16390")},
+		{Key: "public.orders.1", Name: filepath.Join(dir, "16390.1")},
+		{Key: "public.orders_fsm", Name: filepath.Join(dir, "16390_fsm")},
+	}, files)
+}
@@ -0,0 +1,10 @@
+package pgutils
+
+import "github.com/rfyiamcool/pgcacher/pkg/pcstats"
+
+// IsRelationFile reports whether path looks like a data file of a relation,
+// it's pcstats.IsRelationFile, a relfilenode of pcstats.ParseRelationFile
+// under `base/<dboid>/`, `global/` or `pg_tblspc/<spcoid>/<version>/<dboid>/`.
+func IsRelationFile(path string) bool {
+	return pcstats.IsRelationFile(path)
+}
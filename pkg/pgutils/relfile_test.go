@@ -0,0 +1,109 @@
+package pgutils
+
+import (
+	"testing"
+
+	"github.com/rfyiamcool/pgcacher/pkg/pcstats"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsRelationFile(t *testing.T) {
+	for _, path := range []string{
+		"/pgdata/base/5/16384",
+		"/pgdata/base/5/16384.12",
+		"/pgdata/base/5/16384_fsm",
+		"/pgdata/base/5/16384_vm.1",
+		"/pgdata/base/5/t3_16390",
+		"/pgdata/global/1262",
+		"/pgdata/pg_tblspc/16400/PG_14_202107181/5/16401",
+		"base/5/16384_init",
+	} {
+		assert.True(t, IsRelationFile(path), path)
+	}
+
+	for _, path := range []string{
+		"/pgdata/pg_wal/000000010000000000000001",
+		"/pgdata/pg_stat_tmp/global.stat",
+		"/pgdata/postgresql.conf",
+		"/pgdata/postmaster.pid",
+		"/pgdata/global/pg_control",
+		"/pgdata/base/5/pg_filenode.map",
+		"/pgdata/base/5/16384.",
+		"/pgdata/base/5/16384_xyz",
+		"/pgdata/base/pgsql_tmp/16384",
+		"/pgdata/pg_tblspc/16400/5/16401",
+		"16384",
+	} {
+		assert.False(t, IsRelationFile(path), path)
+	}
+}
+
+func TestDatabaseMapper(t *testing.T) {
+	mapper := DatabaseMapper(map[Oid]string{5: "app"})
+
+	assert.Equal(t, "app", mapper("/pgdata/base/5/16384.1"))
+	assert.Equal(t, "app", mapper("/pgdata/pg_tblspc/16400/PG_14_202107181/5/16401"))
+	assert.Equal(t, "16390", mapper("/pgdata/base/16390/16384"))
+	assert.Equal(t, "", mapper("/pgdata/global/1262"))
+	assert.Equal(t, "", mapper("/pgdata/pg_wal/000000010000000000000001"))
+}
+
+func TestRelationKey(t *testing.T) {
+	cases := map[string]string{
+		"/data/base/5/16384":                              "base/5/16384",
+		"/data/base/5/16384_fsm.1":                        "base/5/16384",
+		"/data/base/5/t3_16390_vm":                        "base/5/t3_16390",
+		"/data/global/1262":                               "global/1262",
+		"/data/pg_tblspc/16385/PG_15_202209061/5/16386.2": "pg_tblspc/16385/PG_15_202209061/5/16386",
+	}
+	for path, want := range cases {
+		key, ok := RelationKey(path)
+		assert.True(t, ok, path)
+		assert.Equal(t, want, key, path)
+	}
+
+	_, ok := RelationKey("/data/pg_wal/000000010000000000000001")
+	assert.False(t, ok)
+
+	stats := []pcstats.PcStatus{{Name: "/data/base/5/16384.1"}, {Name: "/data/base/5/16399"}, {Name: "/data/postgresql.conf"}}
+	AnnotateRelNames(stats, map[string]string{"base/5/16384": "public.orders"})
+	assert.Equal(t, "public.orders", stats[0].RelName)
+	assert.Equal(t, "", stats[1].RelName)
+	assert.Equal(t, "", stats[2].RelName)
+}
+
+func TestAnnotateRelPages(t *testing.T) {
+	stats := []pcstats.PcStatus{
+		{Name: "/data/base/5/16384", CachedBlocks: 50},
+		{Name: "/data/base/5/16384_fsm", CachedBlocks: 3},
+		{Name: "/data/base/5/16390", CachedBlocks: 20},
+		{Name: "/data/base/5/16399", CachedBlocks: 1},
+		{Name: "/data/base/5/16384.1", CachedBlocks: 25},
+	}
+	AnnotateRelPages(stats, map[string]int{"base/5/16384": 100, "base/5/16390": 10, "base/5/16399": 0})
+	assert.Equal(t, 100, stats[0].RelPages)
+	assert.Equal(t, 0.75, stats[0].CachedVsRelPages)
+	assert.Equal(t, 0, stats[1].RelPages)
+	assert.Equal(t, 0.0, stats[1].CachedVsRelPages)
+	assert.Equal(t, 2.0, stats[2].CachedVsRelPages)
+	assert.Equal(t, 0.0, stats[3].CachedVsRelPages)
+	assert.Equal(t, 100, stats[4].RelPages)
+	assert.Equal(t, 0.75, stats[4].CachedVsRelPages)
+}
+
+func TestAnnotateDirectIO(t *testing.T) {
+	assert.Equal(t, DirectIO{}, parseDirectIO(""))
+	assert.Equal(t, DirectIO{Data: true}, parseDirectIO("data"))
+	assert.Equal(t, DirectIO{Data: true}, parseDirectIO("data, WAL_INIT"))
+	assert.Equal(t, DirectIO{WAL: true}, parseDirectIO("wal_init,wal"))
+
+	stats := []pcstats.PcStatus{
+		{Name: "/data/base/5/16384"},
+		{Name: "/data/pg_wal/000000010000000000000001"},
+		{Name: "/data/postgresql.conf"},
+	}
+	AnnotateDirectIO(stats, DirectIO{Data: true})
+	assert.True(t, stats[0].DirectIO)
+	assert.False(t, stats[1].DirectIO)
+	assert.False(t, stats[2].DirectIO)
+}
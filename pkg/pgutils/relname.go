@@ -0,0 +1,130 @@
+package pgutils
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/rfyiamcool/pgcacher/pkg/pcstats"
+)
+
+// RelationNames returns the qualified names of the relations of the
+// connected database and of the shared catalogs, such as `public.orders` and
+// `pg_toast.pg_toast_16384`, keyed by the path of their main fork file
+// relative to the data directory, such as `base/5/16384`. the relations of
+// the other databases can only be resolved by connecting to them.
+func RelationNames(conn *sql.DB) (map[string]string, error) {
+	rows, err := conn.Query(`SELECT pg_relation_filepath(c.oid), n.nspname || '.' || c.relname
+		FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE pg_relation_filepath(c.oid) IS NOT NULL`)
+	if err != nil {
+		return nil, fmt.Errorf("could not get relations: %v", err)
+	}
+	defer rows.Close()
+
+	names := make(map[string]string)
+	for rows.Next() {
+		var relpath, name string
+		if err := rows.Scan(&relpath, &name); err != nil {
+			return nil, fmt.Errorf("could not get relations: %v", err)
+		}
+		names[relpath] = name
+	}
+
+	return names, rows.Err()
+}
+
+// RelationKey returns the key of RelationNames of the relation file, the
+// path of its main fork file relative to the data directory, the fork and
+// the segment number are trimmed, `/data/base/5/16384_fsm.1` is
+// `base/5/16384`. it returns false for the files which aren't relations.
+func RelationKey(path string) (string, bool) {
+	if !IsRelationFile(path) {
+		return "", false
+	}
+
+	parts := strings.Split(filepath.ToSlash(filepath.Clean(path)), "/")
+	rf, _ := pcstats.ParseRelationFile(parts[len(parts)-1])
+	base := rf.Relfilenode
+
+	dirs := parts[:len(parts)-1]
+	n := len(dirs)
+	switch {
+	case dirs[n-1] == "global":
+		return "global/" + base, true
+	case n >= 2 && dirs[n-2] == "base":
+		return strings.Join(append(dirs[n-2:n:n], base), "/"), true
+	}
+	return strings.Join(append(dirs[n-4:n:n], base), "/"), true
+}
+
+// AnnotateRelNames sets the RelName of the statuses by the names of
+// RelationNames, it's left empty for the files without a match.
+func AnnotateRelNames(statuses []pcstats.PcStatus, names map[string]string) {
+	for idx := range statuses {
+		if key, ok := RelationKey(statuses[idx].Name); ok {
+			statuses[idx].RelName = names[key]
+		}
+	}
+}
+
+// RelationPages returns relpages of pg_class, the size in blocks of the main
+// fork as of the last VACUUM or ANALYZE, of the relations of RelationNames,
+// keyed the same.
+func RelationPages(conn *sql.DB) (map[string]int, error) {
+	rows, err := conn.Query(`SELECT pg_relation_filepath(c.oid), c.relpages
+		FROM pg_class c WHERE pg_relation_filepath(c.oid) IS NOT NULL`)
+	if err != nil {
+		return nil, fmt.Errorf("could not get relpages: %v", err)
+	}
+	defer rows.Close()
+
+	pages := make(map[string]int)
+	for rows.Next() {
+		var (
+			relpath  string
+			relpages int
+		)
+		if err := rows.Scan(&relpath, &relpages); err != nil {
+			return nil, fmt.Errorf("could not get relpages: %v", err)
+		}
+		pages[relpath] = relpages
+	}
+
+	return pages, rows.Err()
+}
+
+// AnnotateRelPages sets the RelPages of the statuses of the main forks by
+// the relpages of RelationPages, and CachedVsRelPages to the CachedBlocks
+// of the relation against it. relpages is of the whole main fork, so the
+// CachedBlocks of all the segments of the relation in statuses are summed
+// first, and every segment carries the ratio of the relation. a ratio above
+// 1 means the relation grew since it was last analyzed.
+func AnnotateRelPages(statuses []pcstats.PcStatus, pages map[string]int) {
+	var (
+		keys   = make([]string, len(statuses))
+		blocks = make(map[string]int)
+	)
+	for idx, pcs := range statuses {
+		if pcstats.RelationFork(pcs.Name) != pcstats.ForkMain {
+			continue
+		}
+		if key, ok := RelationKey(pcs.Name); ok {
+			keys[idx] = key
+			blocks[key] += pcs.CachedBlocks
+		}
+	}
+
+	for idx, key := range keys {
+		if key == "" {
+			continue
+		}
+
+		pcs := &statuses[idx]
+		pcs.RelPages = pages[key]
+		if pcs.RelPages > 0 {
+			pcs.CachedVsRelPages = float64(blocks[key]) / float64(pcs.RelPages)
+		}
+	}
+}
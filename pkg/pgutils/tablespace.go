@@ -0,0 +1,157 @@
+package pgutils
+
+import (
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Oid is the object identifier of postgresql.
+type Oid uint32
+
+// the oids of the builtin tablespaces.
+const (
+	DefaultTablespace Oid = 1663 // pg_default
+	GlobalTablespace  Oid = 1664 // pg_global
+)
+
+// DiscoverDataDirs returns the directories holding the relation files of
+// every tablespace, keyed by the tablespace oid. pg_default maps to the
+// base dir of data_directory, pg_global to the global dir, the others to
+// their locations, which hold the PG_{version}_{catversion} dirs.
+func DiscoverDataDirs(conn *sql.DB) (map[Oid]string, error) {
+	dataDir, err := DataDirectory(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := conn.Query("SELECT oid, pg_tablespace_location(oid) FROM pg_tablespace")
+	if err != nil {
+		return nil, fmt.Errorf("could not get tablespaces: %v", err)
+	}
+	defer rows.Close()
+
+	dirs := map[Oid]string{
+		DefaultTablespace: filepath.Join(dataDir, "base"),
+		GlobalTablespace:  filepath.Join(dataDir, "global"),
+	}
+	for rows.Next() {
+		var (
+			oid      Oid
+			location string
+		)
+		if err := rows.Scan(&oid, &location); err != nil {
+			return nil, fmt.Errorf("could not get tablespaces: %v", err)
+		}
+		if location != "" {
+			dirs[oid] = location
+		}
+	}
+
+	return dirs, rows.Err()
+}
+
+// relationFullPath converts the path from pg_relation_filepath, which is
+// relative to the data directory, into the full path by the directory of
+// its tablespace. so the tables of other tablespaces are found without
+// following the pg_tblspc symlinks.
+func relationFullPath(dirs map[Oid]string, relpath string) string {
+	parts := strings.SplitN(relpath, "/", 3)
+
+	switch {
+	case parts[0] == "base" && len(parts) > 1:
+		return filepath.Join(dirs[DefaultTablespace], strings.Join(parts[1:], "/"))
+	case parts[0] == "global" && len(parts) == 2:
+		return filepath.Join(dirs[GlobalTablespace], parts[1])
+	case parts[0] == "pg_tblspc" && len(parts) == 3:
+		oid, err := strconv.ParseUint(parts[1], 10, 32)
+		if dir, ok := dirs[Oid(oid)]; err == nil && ok {
+			return filepath.Join(dir, parts[2])
+		}
+	}
+
+	// unknown layout, resolve it against the data directory.
+	return filepath.Join(filepath.Dir(dirs[DefaultTablespace]), relpath)
+}
+
+// Tablespace is the layout of a tablespace on disk, see ResolveTablespace.
+type Tablespace struct {
+	Oid        Oid
+	Location   string         // target of the pg_tblspc symlink
+	VersionDir string         // the PG_{version}_{catversion} dir under Location
+	Databases  map[Oid]string // the dirs of the relation files keyed by the database oid
+}
+
+// ResolveTablespace resolves the symlink of pg_tblspc, such as
+// `$PGDATA/pg_tblspc/16500`, to the dirs of the databases holding the
+// relation files, without connecting to the server. versionDir picks the
+// PG_{version}_{catversion} dir, such as `PG_15_202209061`, an empty one
+// means the only one, there may be more than one after pg_upgrade.
+func ResolveTablespace(entry, versionDir string) (*Tablespace, error) {
+	oid, err := strconv.ParseUint(filepath.Base(entry), 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tablespace entry %q: %v", entry, err)
+	}
+
+	location, err := os.Readlink(entry)
+	if err != nil {
+		return nil, fmt.Errorf("could not read the tablespace symlink: %v", err)
+	}
+	if !filepath.IsAbs(location) {
+		location = filepath.Join(filepath.Dir(entry), location)
+	}
+
+	if versionDir == "" {
+		versionDir, err = findVersionDir(location)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	entries, err := ioutil.ReadDir(filepath.Join(location, versionDir))
+	if err != nil {
+		return nil, fmt.Errorf("could not read the tablespace dir: %v", err)
+	}
+
+	ts := &Tablespace{
+		Oid:        Oid(oid),
+		Location:   location,
+		VersionDir: versionDir,
+		Databases:  make(map[Oid]string),
+	}
+	for _, e := range entries {
+		dboid, err := strconv.ParseUint(e.Name(), 10, 32)
+		if err != nil || !e.IsDir() {
+			continue
+		}
+		ts.Databases[Oid(dboid)] = filepath.Join(location, versionDir, e.Name())
+	}
+	return ts, nil
+}
+
+// findVersionDir returns the only PG_{version}_{catversion} dir of location.
+func findVersionDir(location string) (string, error) {
+	entries, err := ioutil.ReadDir(location)
+	if err != nil {
+		return "", fmt.Errorf("could not read the tablespace location: %v", err)
+	}
+
+	var dirs []string
+	for _, e := range entries {
+		if e.IsDir() && strings.HasPrefix(e.Name(), "PG_") {
+			dirs = append(dirs, e.Name())
+		}
+	}
+
+	switch len(dirs) {
+	case 0:
+		return "", fmt.Errorf("no version dir in the tablespace location %q", location)
+	case 1:
+		return dirs[0], nil
+	}
+	return "", fmt.Errorf("more than one version dirs in the tablespace location %q: %s", location, strings.Join(dirs, ", "))
+}
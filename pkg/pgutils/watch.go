@@ -0,0 +1,88 @@
+package pgutils
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rfyiamcool/pgcacher/pkg/pcstats"
+)
+
+// RelationResolver returns a pcstats.WatchResolver of the files of the
+// relation, such as `public.orders`, which resolves the current
+// relfilenode at every sample, so a watch keeps following the table across
+// VACUUM FULL, CLUSTER and TRUNCATE. the relation is looked up by its name
+// once and followed by its oid, so a table dropped and created again by the
+// same name is reported as gone rather than silently swapped. the keys are
+// the relation name with the fork and the segment of the file, such as
+// `public.orders_fsm` and `public.orders.1`.
+func RelationResolver(conn *sql.DB, relname string) (pcstats.WatchResolver, error) {
+	oid, err := relationOid(conn, relname)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() ([]pcstats.WatchFile, error) {
+		dirs, err := DiscoverDataDirs(conn)
+		if err != nil {
+			return nil, err
+		}
+
+		var relpath sql.NullString
+		err = conn.QueryRow(
+			"SELECT pg_relation_filepath(c.oid) FROM pg_class c WHERE c.oid = $1",
+			oid,
+		).Scan(&relpath)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("relation %q of oid %d is gone", relname, oid)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not resolve relation %q: %v", relname, err)
+		}
+		if !relpath.Valid {
+			return nil, fmt.Errorf("relation %q has no files", relname)
+		}
+
+		return watchFiles(relname, relationFullPath(dirs, relpath.String)), nil
+	}, nil
+}
+
+// watchFiles returns the segments of the relation whose main fork file is
+// base, keyed by relname with the suffix of the fork and the segment.
+func watchFiles(relname, base string) []pcstats.WatchFile {
+	segments := RelationSegments(base)
+	files := make([]pcstats.WatchFile, len(segments))
+	for idx, fname := range segments {
+		files[idx] = pcstats.WatchFile{
+			Key:  relname + strings.TrimPrefix(fname, base),
+			Name: fname,
+		}
+	}
+	return files
+}
+
+// WatchRelation is pcstats.WatchPcStatusFunc of the files of the relation by
+// RelationResolver.
+func WatchRelation(ctx context.Context, conn *sql.DB, relname string, interval time.Duration, ch chan<- []pcstats.PcStatus, opts pcstats.BatchOptions) error {
+	resolve, err := RelationResolver(conn, relname)
+	if err != nil {
+		close(ch)
+		return err
+	}
+	return pcstats.WatchPcStatusFunc(ctx, resolve, interval, ch, opts)
+}
+
+// relationOid returns the oid of the relation by to_regclass.
+func relationOid(conn *sql.DB, relname string) (Oid, error) {
+	var oid sql.NullInt64
+	if err := conn.QueryRow("SELECT to_regclass($1)::oid", relname).Scan(&oid); err != nil {
+		return 0, fmt.Errorf("could not resolve relation %q: %v", relname, err)
+	}
+	if !oid.Valid {
+		return 0, fmt.Errorf("relation %q not found", relname)
+	}
+	return Oid(oid.Int64), nil
+}